@@ -0,0 +1,319 @@
+/*
+* Copyright 2025-2026 Thorsten A. Knieling
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*    http://www.apache.org/licenses/LICENSE-2.0
+*
+ */
+
+package ecoflow2db
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/eclipse/paho.golang/paho"
+	"github.com/tknie/log"
+)
+
+const (
+	// ActuatorCloud set-point is written through the Ecoflow cloud API
+	ActuatorCloud = "cloud"
+	// ActuatorMQTT set-point is published to a MQTT command topic
+	ActuatorMQTT = "mqtt"
+	// ActuatorHTTP set-point is send by a generic HTTP request
+	ActuatorHTTP = "http"
+	// ActuatorOpenDTU set-point is written as limit using the OpenDTU API
+	ActuatorOpenDTU = "opendtu"
+)
+
+const defaultActuatorPayload = "{{.Watts}}"
+const actuatorTimeout = 10 * time.Second
+
+// actuatorConfig defines how the power request is written. Topic, URL,
+// Payload and Body are templates using .Target, .Value and .Watts
+type actuatorConfig struct {
+	Type        string `yaml:"type"`
+	Target      string `yaml:"target"`
+	Topic       string `yaml:"topic"`
+	Qos         int    `yaml:"qos"`
+	Retain      bool   `yaml:"retain"`
+	Payload     string `yaml:"payload"`
+	URL         string `yaml:"url"`
+	Method      string `yaml:"method"`
+	ContentType string `yaml:"contentType"`
+	Body        string `yaml:"body"`
+	Username    string `yaml:"username"`
+	Password    string `yaml:"password"`
+	LimitType   int    `yaml:"limitType"`
+}
+
+// actuator writes the power request to the inverter
+type actuator interface {
+	setPower(target string, value float64) error
+	// readBack true if the current request can be read by the Ecoflow API
+	readBack() bool
+}
+
+// actuatorRequest template data of the actuator
+type actuatorRequest struct {
+	Target string
+	Value  float64
+	Watts  int64
+}
+
+type cloudActuator struct{}
+
+type mqttActuator struct {
+	config *actuatorConfig
+}
+
+type httpActuator struct {
+	config *actuatorConfig
+	client *http.Client
+}
+
+type openDTUActuator struct {
+	httpActuator
+}
+
+// powerActuator actuator of the current configuration, created once and
+// replaced on configuration reload
+var powerActuator actuator
+var actuatorLock sync.Mutex
+
+// newActuator create the actuator of the configuration
+func (ac *actuatorConfig) newActuator() (actuator, error) {
+	if ac == nil {
+		return &cloudActuator{}, nil
+	}
+	switch ac.Type {
+	case "", ActuatorCloud:
+		return &cloudActuator{}, nil
+	case ActuatorMQTT:
+		if ac.Topic == "" {
+			return nil, fmt.Errorf("MQTT actuator need a topic")
+		}
+		return &mqttActuator{config: ac}, nil
+	case ActuatorHTTP:
+		if ac.URL == "" {
+			return nil, fmt.Errorf("HTTP actuator need an URL")
+		}
+		return &httpActuator{config: ac, client: &http.Client{Timeout: actuatorTimeout}}, nil
+	case ActuatorOpenDTU:
+		if ac.URL == "" {
+			return nil, fmt.Errorf("OpenDTU actuator need an URL")
+		}
+		return &openDTUActuator{httpActuator{config: ac, client: &http.Client{Timeout: actuatorTimeout}}}, nil
+	default:
+		return nil, fmt.Errorf("unknown actuator type %s", ac.Type)
+	}
+}
+
+// setActuator use the actuator for all following power requests
+func setActuator(a actuator) {
+	actuatorLock.Lock()
+	defer actuatorLock.Unlock()
+	powerActuator = a
+}
+
+// getActuator actuator of the current configuration, it is created with
+// the first usage if the configuration is not evaluated
+func getActuator() (actuator, error) {
+	actuatorLock.Lock()
+	defer actuatorLock.Unlock()
+	if powerActuator == nil {
+		a, err := adapter.Actuator.newActuator()
+		if err != nil {
+			return nil, err
+		}
+		powerActuator = a
+	}
+	return powerActuator, nil
+}
+
+// powerTarget device the power request is written to, default is the
+// first micro converter
+func powerTarget() string {
+	if adapter.Actuator != nil && adapter.Actuator.Target != "" {
+		return os.ExpandEnv(adapter.Actuator.Target)
+	}
+	if adapter.EcoflowConfig == nil || len(adapter.EcoflowConfig.MicroConverter) == 0 {
+		return ""
+	}
+	return os.ExpandEnv(adapter.EcoflowConfig.MicroConverter[0])
+}
+
+// powerReadBack check if the current request can be read from the Ecoflow
+// API, otherwise the last written request is used
+func powerReadBack() bool {
+	a, err := getActuator()
+	return err == nil && a.readBack()
+}
+
+// setPowerRequest write the power request using the configured actuator
+func setPowerRequest(target string, value float64) error {
+	a, err := getActuator()
+	if err != nil {
+		return err
+	}
+	err = a.setPower(target, value)
+	if err != nil {
+		log.Log.Errorf("Error setting power request %0.1f of %s: %v", value, target, err)
+		return err
+	}
+	if !a.readBack() {
+		currentRequested = value
+	}
+	return nil
+}
+
+func (ca *cloudActuator) setPower(target string, value float64) error {
+	if client == nil {
+		return fmt.Errorf("Ecoflow client not initialized")
+	}
+	client.SetEnvironmentPowerConsumption(target, value)
+	return nil
+}
+
+func (ca *cloudActuator) readBack() bool {
+	return true
+}
+
+// expand execute the template with the request data
+func expand(name, text string, target string, value float64) (string, error) {
+	t, err := template.New(name).Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var buffer bytes.Buffer
+	err = t.Execute(&buffer, &actuatorRequest{Target: target, Value: value,
+		Watts: int64(math.Round(value))})
+	if err != nil {
+		return "", err
+	}
+	return buffer.String(), nil
+}
+
+func (ma *mqttActuator) setPower(target string, value float64) error {
+	if mqttClient == nil {
+		return fmt.Errorf("MQTT not connected")
+	}
+	topic, err := expand("topic", ma.config.Topic, target, value)
+	if err != nil {
+		return err
+	}
+	text := ma.config.Payload
+	if text == "" {
+		text = defaultActuatorPayload
+	}
+	payload, err := expand("payload", text, target, value)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), actuatorTimeout)
+	defer cancel()
+	_, err = mqttClient.Publish(ctx, &paho.Publish{Topic: topic, Retain: ma.config.Retain,
+		QoS: byte(ma.config.Qos), Payload: []byte(payload)})
+	return err
+}
+
+func (ma *mqttActuator) readBack() bool {
+	return false
+}
+
+func (ha *httpActuator) setPower(target string, value float64) error {
+	u, err := expand("url", ha.config.URL, target, value)
+	if err != nil {
+		return err
+	}
+	body := ""
+	if ha.config.Body != "" {
+		body, err = expand("body", ha.config.Body, target, value)
+		if err != nil {
+			return err
+		}
+	}
+	method := ha.config.Method
+	if method == "" {
+		method = http.MethodGet
+		if body != "" {
+			method = http.MethodPost
+		}
+	}
+	_, err = ha.do(method, u, ha.config.ContentType, body)
+	return err
+}
+
+// do send the request and return the response body
+func (ha *httpActuator) do(method, u, contentType, body string) ([]byte, error) {
+	req, err := http.NewRequest(method, os.ExpandEnv(u), strings.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if ha.config.Username != "" {
+		req.SetBasicAuth(ha.config.Username, os.ExpandEnv(ha.config.Password))
+	}
+	resp, err := ha.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("HTTP status %s: %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+	return data, nil
+}
+
+func (ha *httpActuator) readBack() bool {
+	return false
+}
+
+// setPower write the limit with the OpenDTU limit API, the target is the
+// Hoymiles inverter serial number
+func (oa *openDTUActuator) setPower(target string, value float64) error {
+	limit, err := json.Marshal(map[string]interface{}{"serial": target,
+		"limit_type": oa.config.LimitType, "limit_value": int64(math.Round(value))})
+	if err != nil {
+		return err
+	}
+	form := url.Values{"data": {string(limit)}}
+	data, err := oa.do(http.MethodPost, strings.TrimSuffix(oa.config.URL, "/")+"/api/limit/config",
+		"application/x-www-form-urlencoded", form.Encode())
+	if err != nil {
+		return err
+	}
+	result := struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	}{}
+	err = json.Unmarshal(data, &result)
+	if err != nil {
+		return fmt.Errorf("invalid OpenDTU response: %v", err)
+	}
+	if result.Type != "success" {
+		return fmt.Errorf("OpenDTU limit not set: %s", result.Message)
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+/*
+* Copyright 2025-2026 Thorsten A. Knieling
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*    http://www.apache.org/licenses/LICENSE-2.0
+*
+ */
+
+package ecoflow2db
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTPActuator(t *testing.T) {
+	var method, path, query, body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method = r.Method
+		path = r.URL.Path
+		query = r.URL.RawQuery
+		b, _ := io.ReadAll(r.Body)
+		body = string(b)
+		if r.URL.Path == "/api/limit/config" {
+			user, password, _ := r.BasicAuth()
+			if user != "admin" || password != "secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte(`{"type":"success","message":"Settings saved!","code":1001}`))
+		}
+	}))
+	defer server.Close()
+
+	a, err := (&actuatorConfig{Type: ActuatorHTTP, URL: server.URL + "/limit?sn={{.Target}}&w={{.Watts}}"}).newActuator()
+	assert.NoError(t, err)
+	assert.False(t, a.readBack())
+	assert.NoError(t, a.setPower("HM123", 199.6))
+	assert.Equal(t, http.MethodGet, method)
+	assert.Equal(t, "/limit", path)
+	assert.Equal(t, "sn=HM123&w=200", query)
+
+	a, err = (&actuatorConfig{Type: ActuatorHTTP, URL: server.URL + "/set", ContentType: "application/json",
+		Body: `{"power":{{.Value}}}`}).newActuator()
+	assert.NoError(t, err)
+	assert.NoError(t, a.setPower("HM123", 150.5))
+	assert.Equal(t, http.MethodPost, method)
+	assert.Equal(t, `{"power":150.5}`, body)
+
+	a, err = (&actuatorConfig{Type: ActuatorOpenDTU, URL: server.URL + "/", Username: "admin",
+		Password: "secret"}).newActuator()
+	assert.NoError(t, err)
+	assert.NoError(t, a.setPower("114182912345", 300))
+	assert.Equal(t, "/api/limit/config", path)
+	form, err := url.ParseQuery(body)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"serial":"114182912345","limit_type":0,"limit_value":300}`, form.Get("data"))
+
+	a, _ = (&actuatorConfig{Type: ActuatorOpenDTU, URL: server.URL, Username: "admin"}).newActuator()
+	assert.Error(t, a.setPower("114182912345", 300))
+
+	_, err = (&actuatorConfig{Type: ActuatorMQTT}).newActuator()
+	assert.Error(t, err)
+	_, err = (&actuatorConfig{Type: "xyz"}).newActuator()
+	assert.Error(t, err)
+	a, err = (*actuatorConfig)(nil).newActuator()
+	assert.NoError(t, err)
+	assert.True(t, a.readBack())
+
+	// the actuator is created once and kept until it is replaced
+	a, _ = (&actuatorConfig{Type: ActuatorHTTP, URL: server.URL}).newActuator()
+	setActuator(a)
+	defer setActuator(nil)
+	current, err := getActuator()
+	assert.NoError(t, err)
+	assert.Same(t, a, current)
+	assert.False(t, powerReadBack())
+}
@@ -48,6 +48,10 @@ func main() {
 	caracon := false
 	serialNumber := ""
 	listDevices := false
+	listDeadLetter := false
+	replayDeadLetter := false
+	replayFile := ""
+	replaySpeed := float64(1)
 
 	flag.IntVar(&ecoflow2db.LoopSeconds, "t", ecoflow2db.LoopSeconds, "The seconds wating between REST API queries")
 	flag.IntVar(&statSecs, "s", int(ecoflow2db.StatLoopMinutes), "The minutes waiting between statistics output")
@@ -58,9 +62,13 @@ func main() {
 	flag.BoolVar(&caracon, "c", false, "Power car AC on")
 	flag.BoolVar(&test, "T", false, "Do tests and output only")
 	flag.BoolVar(&listDevices, "l", false, "List of Ecoflow devices")
+	flag.BoolVar(&listDeadLetter, "deadletter", false, "List MQTT dead-letter entries")
+	flag.BoolVar(&replayDeadLetter, "reparse", false, "Parse MQTT dead-letter entries with current mapping")
 	flag.StringVar(&serialNumber, "S", "", "Use serial number")
 	flag.StringVar(&flowControlFile, "f", "", "Load YAML control file")
 	flag.Float64Var(&powervalue, "p", 0, "Set new power value for the power powerstream")
+	flag.StringVar(&replayFile, "replay", "", "Replay recorded MQTT traffic files matching the pattern")
+	flag.Float64Var(&replaySpeed, "speed", replaySpeed, "Replay speed factor, 0 replays without delay")
 
 	flag.Parse()
 
@@ -76,7 +84,11 @@ func main() {
 	switch {
 	case powervalue > 0:
 		services.ServerMessage("Set new power value for powerstream to %f", powervalue)
-		ecoflow2db.SetEnvironmentPowerConsumption(powervalue)
+		err := ecoflow2db.SetEnvironmentPowerConsumption(powervalue)
+		if err != nil {
+			services.ServerMessage("Error setting power value: %v", err)
+			os.Exit(1)
+		}
 		return
 	case caracon:
 		services.ServerMessage("Set AC car power on")
@@ -86,6 +98,18 @@ func main() {
 		services.ServerMessage("List of Ecoflow devices")
 		ecoflow2db.ListDevices()
 		return
+	case listDeadLetter:
+		services.ServerMessage("List of MQTT dead-letter entries")
+		ecoflow2db.ListDeadLetters()
+		return
+	case replayDeadLetter:
+		services.ServerMessage("Parse MQTT dead-letter entries")
+		ecoflow2db.ReplayDeadLetters()
+		return
+	case replayFile != "":
+		services.ServerMessage("Replay recorded MQTT traffic %s", replayFile)
+		ecoflow2db.ReplayRecording(replayFile, replaySpeed)
+		return
 	}
 
 	// Go into server mode
@@ -14,10 +14,10 @@ package ecoflow2db
 import (
 	"bytes"
 	"fmt"
-	"html/template"
 	"math"
 	"os"
 	"sort"
+	"text/template"
 	"time"
 
 	"github.com/tknie/flynn/common"
@@ -27,37 +27,39 @@ import (
 
 const DefaultIntermediateSize = 15
 
+// SELECT_GET_ALL_PARAMETER flow query, backend specific parts are rendered
+// by the SQL dialect .D
 const SELECT_GET_ALL_PARAMETER = `
 with battery as (
 select
-	to_char(dq.eco_timestamp at TIME zone 'GMT', 'YYYYMMDD HH24MI') as timest,
-	row_number() over (partition by to_char(dq.eco_timestamp at TIME zone 'GMT' , 'YYYYMMDD HH24MI')) as rn,
+	{{ .D.MinuteKey (.D.UTC "dq.eco_timestamp") }} as timest,
+	row_number() over (partition by {{ .D.MinuteKey (.D.UTC "dq.eco_timestamp") }}) as rn,
 	eco_bms_bmsstatus_actsoc as batfill
 from
 	{{ .EcoflowTable }} dq
 where
 	dq.eco_serial_number = upper('{{ .BatteryConverterSerialNumber }}')
-	and eco_timestamp at TIME zone 'GMT' >= NOW() - '30 minute'::interval
+	and {{ .D.Since "eco_timestamp" 30 }}
 order by
 	dq.eco_timestamp desc
 ),
 adapter as (
 select
-	dq.eco_timestamp at TIME zone 'GMT',
-	to_char(dq.eco_timestamp at TIME zone 'GMT', 'YYYYMMDD HH24MI') as timest,
-	row_number() over (partition by to_char(dq.eco_timestamp at TIME zone 'GMT', 'YYYYMMDD HH24MI')) as rn,
-		(eco_20_1_pv1inputwatts + eco_20_1_pv2inputwatts)/ 10 as "solargen" ,
-	abs(least( eco_20_1_batinputwatts::float / 10, 0)) as "batinput",
-	abs(greatest( eco_20_1_batinputwatts::float / 10, 0)) as "batout",
-	eco_20_1_genewatt / 10 as "housein",
-	abs(eco_20_1_gridconswatts::float / 10) as "gridwatts",
-	eco_20_1_invdemandwatts / 10 as "requested",
-	eco_20_1_bmsreqchgamp as "batreqfill"
+	{{ .D.UTC "dq.eco_timestamp" }} as timezone,
+	{{ .D.MinuteKey (.D.UTC "dq.eco_timestamp") }} as timest,
+	row_number() over (partition by {{ .D.MinuteKey (.D.UTC "dq.eco_timestamp") }}) as rn,
+		{{ .D.IntDiv "eco_20_1_pv1inputwatts + eco_20_1_pv2inputwatts" 10 }} as solargen ,
+	abs(least( {{ .D.Float "eco_20_1_batinputwatts" }} / 10, 0)) as batinput,
+	abs(greatest( {{ .D.Float "eco_20_1_batinputwatts" }} / 10, 0)) as batout,
+	{{ .D.IntDiv "eco_20_1_genewatt" 10 }} as housein,
+	abs({{ .D.Float "eco_20_1_gridconswatts" }} / 10) as gridwatts,
+	{{ .D.IntDiv "eco_20_1_invdemandwatts" 10 }} as requested,
+	eco_20_1_bmsreqchgamp as batreqfill
 from
 	{{ .EcoflowTable }} dq
 where
 	dq.eco_serial_number = upper('{{ .ConverterSerialNumber }}')
-		and dq.eco_timestamp at TIME zone 'GMT' >= NOW() - '30 minute'::interval
+		and {{ .D.Since "dq.eco_timestamp" 30 }}
 	order by
 		dq.eco_timestamp desc
 )
@@ -76,9 +78,9 @@ select
 from
 	battery b
 inner join {{ .EnergyTable }} h on
-	b.timest = to_char(h.inserted_on , 'YYYYMMDD HH24MI')
+	b.timest = {{ .D.MinuteKey "h.inserted_on" }}
 inner join adapter a on
-	a.timest = to_char(h.inserted_on , 'YYYYMMDD HH24MI')
+	a.timest = {{ .D.MinuteKey "h.inserted_on" }}
 where
 	b.rn = 1
 	and a.rn = 1
@@ -140,31 +142,58 @@ func StartFlow(test bool) {
 	}
 }
 
-func ReadCurrentFlow() ([]*parameter, error) {
-	log.Log.Debugf("Read current flow")
-	tn := adapter.DatabaseConfig.Table
-	tnHome := adapter.DatabaseConfig.EnergyTable
+// flowQuery render the flow query for the SQL dialect
+func flowQuery(d sqlDialect, tn, tnHome, converter, battery string) string {
 	tmpl, err := template.New("sql").Parse(SELECT_GET_ALL_PARAMETER)
 	if err != nil {
 		panic(err)
 	}
 	var buffer bytes.Buffer
 	err = tmpl.Execute(&buffer, struct {
+		D                            sqlDialect
 		EcoflowTable                 string
 		EnergyTable                  string
 		ConverterSerialNumber        string
 		BatteryConverterSerialNumber string
-	}{EcoflowTable: tn, EnergyTable: tnHome,
-		ConverterSerialNumber:        os.ExpandEnv(adapter.EcoflowConfig.MicroConverter[0]),
-		BatteryConverterSerialNumber: os.ExpandEnv(adapter.EcoflowConfig.Battery[0])})
+	}{D: d, EcoflowTable: tn, EnergyTable: tnHome,
+		ConverterSerialNumber:        converter,
+		BatteryConverterSerialNumber: battery})
 	if err != nil {
 		panic(err)
 	}
+	return buffer.String()
+}
+
+// parseFlowRow flow parameter of one result row, fieldMap contains the
+// index of the result fields
+func parseFlowRow(fieldMap map[string]int, rows []any) *parameter {
+	p := &parameter{}
+	p.timestamp = resultTime(rows[fieldMap["inserted_on"]])
+	p.solargen = resultInt64(rows[fieldMap["solargen"]])
+	p.batinput = resultFloat64(rows[fieldMap["batinput"]])
+	p.batout = resultFloat64(rows[fieldMap["batout"]])
+	p.housein = resultInt64(rows[fieldMap["housein"]])
+	p.gridwatts = resultFloat64(rows[fieldMap["gridwatts"]])
+	p.requested = resultInt64(rows[fieldMap["requested"]])
+	p.batreqfill = resultInt64(rows[fieldMap["batreqfill"]])
+	p.powercurr = int32(resultInt64(rows[fieldMap["powercurr"]]))
+	p.powerout = int32(resultInt64(rows[fieldMap["powerout"]]))
+	p.batfill = resultInt64(rows[fieldMap["batfill"]])
+	return p
+}
+
+func ReadCurrentFlow() ([]*parameter, error) {
+	log.Log.Debugf("Read current flow")
+	tn := adapter.DatabaseConfig.Table
+	tnHome := adapter.DatabaseConfig.EnergyTable
+	query := flowQuery(currentDialect(), tn, tnHome,
+		os.ExpandEnv(adapter.EcoflowConfig.MicroConverter[0]),
+		os.ExpandEnv(adapter.EcoflowConfig.Battery[0]))
 	readid := connnectDatabase()
 	headerOutput := true
 	lastLimitEntries := make([]*parameter, 0)
 	fieldMap := make(map[string]int)
-	err = readBatch(readid, tn, buffer.String(), func(search *common.Query, result *common.Result) error {
+	err := readBatch(readid, tn, query, func(search *common.Query, result *common.Result) error {
 		if headerOutput {
 			log.Log.Debugf("LEN: %d->%d", len(fieldMap), len(result.Fields))
 			header := ""
@@ -180,28 +209,17 @@ func ReadCurrentFlow() ([]*parameter, error) {
 			log.Log.Debugf("Header: %s", header)
 			headerOutput = false
 		}
-		p := &parameter{}
-		p.timestamp = result.Rows[fieldMap["timezone"]].(time.Time)
-		p.solargen = result.Rows[fieldMap["solargen"]].(int64)
-		p.batinput = result.Rows[fieldMap["batinput"]].(float64)
-		p.batout = result.Rows[fieldMap["batout"]].(float64)
-		p.housein = result.Rows[fieldMap["housein"]].(int64)
-		p.gridwatts = result.Rows[fieldMap["gridwatts"]].(float64)
-		p.requested = result.Rows[fieldMap["requested"]].(int64)
-		p.batreqfill = result.Rows[fieldMap["batreqfill"]].(int64)
-		p.powercurr = result.Rows[fieldMap["powercurr"]].(int32)
-		p.powerout = result.Rows[fieldMap["powerout"]].(int32)
-		p.batfill = result.Rows[fieldMap["batfill"]].(int64)
+		p := parseFlowRow(fieldMap, result.Rows)
 		lastLimitEntries = append(lastLimitEntries, p)
 		log.Log.Debugf("Record: %s", p.toString())
 		return nil
 	})
 	if err != nil {
-		log.Log.Errorf("Read flow error: %v (sql = %s)", err, buffer.String())
+		log.Log.Errorf("Read flow error: %v (sql = %s)", err, query)
 		return nil, err
 	}
 	if len(lastLimitEntries) == 0 {
-		log.Log.Infof("No flow entries found, sql call: %s", buffer.String())
+		log.Log.Infof("No flow entries found, sql call: %s", query)
 	}
 	log.Log.Infof("Read %d flow entries", len(lastLimitEntries))
 	return lastLimitEntries, nil
@@ -212,7 +230,7 @@ func AnalyzeEnergyHistory(lastLimitEntries []*parameter, test bool) {
 		log.Log.Infof("No last limit entries found")
 		return
 	}
-	converter := os.ExpandEnv(adapter.EcoflowConfig.MicroConverter[0])
+	converter := powerTarget()
 	services.ServerMessage("Requested:  %d", lastLimitEntries[0].requested)
 	services.ServerMessage("Powerout:   %d", lastLimitEntries[0].powerout)
 	lastRequested := lastLimitEntries[0].requested
@@ -230,7 +248,7 @@ func AnalyzeEnergyHistory(lastLimitEntries []*parameter, test bool) {
 			newRequested = adapter.DefaultConfig.BaseRequest
 		}
 		if adapter.DefaultConfig.DynamicRequest && !test && newRequested != lastRequested {
-			client.SetEnvironmentPowerConsumption(converter, float64(newRequested))
+			setPowerRequest(converter, float64(newRequested))
 		}
 		return
 	}
@@ -286,7 +304,7 @@ func AnalyzeEnergyHistory(lastLimitEntries []*parameter, test bool) {
 	if newRequested > adapter.DefaultConfig.BaseRequest {
 		log.Log.Infof("Set request to converter %s: %d", converter, newRequested)
 		if adapter.DefaultConfig.DynamicRequest && !test && newRequested != lastRequested {
-			client.SetEnvironmentPowerConsumption(converter, float64(newRequested))
+			setPowerRequest(converter, float64(newRequested))
 		} else {
 			log.Log.Infof("Dynamic request = %v, test = %v or new requested is same as last requested %d, computed value: %d",
 				adapter.DefaultConfig.DynamicRequest, test, lastRequested, newRequested)
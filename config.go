@@ -16,6 +16,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"sync"
 
 	"github.com/stretchr/testify/assert/yaml"
 	"github.com/tknie/log"
@@ -26,35 +27,58 @@ type adapterConfig struct {
 	DefaultConfig  *defaultConfig  `yaml:"default"`
 	DatabaseConfig *databaseConfig `yaml:"database"`
 	Mqtt           *mqttConfig     `yaml:"mqtt"`
+	Meters         *meterConfig    `yaml:"meters"`
+	Actuator       *actuatorConfig `yaml:"actuator"`
 	EcoflowConfig  *ecoflowConfig  `yaml:"ecoflow"`
 }
 
 type defaultConfig struct {
-	DynamicRequest          bool   `yaml:"dynamicRequest"`
-	RealtimeRequest         bool   `yaml:"realtimeRequest"`
-	WaitAfterRequestSeconds int64  `yaml:"waitAfterRequestSeconds"`
-	BaseRequest             int64  `yaml:"baseWatt"`
-	UpperBatLimit           int64  `yaml:"upperBatLimit"`
-	IntermediateSize        int64  `yaml:"intermediateSize"`
-	Debug                   string `yaml:"debug"`
+	DynamicRequest          bool         `yaml:"dynamicRequest"`
+	RealtimeRequest         bool         `yaml:"realtimeRequest"`
+	WaitAfterRequestSeconds int64        `yaml:"waitAfterRequestSeconds"`
+	BaseRequest             int64        `yaml:"baseWatt"`
+	UpperBatLimit           int64        `yaml:"upperBatLimit"`
+	IntermediateSize        int64        `yaml:"intermediateSize"`
+	Phases                  *phaseConfig `yaml:"phases"`
+	Debug                   string       `yaml:"debug"`
 }
 
 type mqttConfig struct {
-	Server              string   `yaml:"server"`
-	Username            string   `yaml:"username"`
-	Password            string   `yaml:"password"`
-	LoopIntervalSeconds int      `yaml:"loopIntervalSeconds"`
-	Qos                 int      `yaml:"qos"`
-	Clientid            string   `yaml:"clientID"`
-	MaxTries            int      `yaml:"maxTries"`
-	Topics              []*Topic `yaml:"topics"`
+	Server              string            `yaml:"server"`
+	Username            string            `yaml:"username"`
+	Password            string            `yaml:"password"`
+	LoopIntervalSeconds int               `yaml:"loopIntervalSeconds"`
+	Qos                 int               `yaml:"qos"`
+	Clientid            string            `yaml:"clientID"`
+	MaxTries            int               `yaml:"maxTries"`
+	QueueSize           int               `yaml:"queueSize"`
+	Topics              []*Topic          `yaml:"topics"`
+	DeadLetter          *deadLetterConfig `yaml:"deadLetter"`
+	Publish             *publishConfig    `yaml:"publish"`
+	Record              *recordConfig     `yaml:"record"`
+}
+
+// meterConfig meter sources polled by the application, the readings are
+// handled like MQTT topic messages
+type meterConfig struct {
+	HTTP   []*httpMeter   `yaml:"http"`
+	Modbus []*modbusMeter `yaml:"modbus"`
 }
 
 type databaseConfig struct {
-	Target      string `yaml:"target"`
-	TableName   string `yaml:"tableName"`
-	Table       string `yaml:"ecoflowTable"`
-	EnergyTable string `yaml:"energyTable"`
+	Target          string            `yaml:"target"`
+	TableName       string            `yaml:"tableName"`
+	Table           string            `yaml:"ecoflowTable"`
+	EnergyTable     string            `yaml:"energyTable"`
+	BatchSize       int               `yaml:"batchSize"`
+	FlushIntervalMs int               `yaml:"flushIntervalMs"`
+	Spool           *spoolConfig      `yaml:"spool"`
+	Timescale       *timescaleConfig  `yaml:"timescale"`
+	Rollup          *rollupConfig     `yaml:"rollup"`
+	Retention       *retentionConfig  `yaml:"retention"`
+	LongFormat      *longFormatConfig `yaml:"longFormat"`
+	KeyFilters      []*keyFilter      `yaml:"keyFilters"`
+	Deadband        *deadbandConfig   `yaml:"deadband"`
 }
 
 type ecoflowConfig struct {
@@ -123,6 +147,17 @@ func evaluateConfig(file string) {
 		if adapter.DefaultConfig.UpperBatLimit == 0 {
 			adapter.DefaultConfig.UpperBatLimit = defaultMaxRequest
 		}
+		a, err := adapter.Actuator.newActuator()
+		if err == nil {
+			setActuator(a)
+			err = adapter.validate()
+		} else {
+			err = fmt.Errorf("error in actuator configuration: %v", err)
+		}
+		if err != nil {
+			services.ServerMessage("Shuting down ... error in configuration %s: %v", file, err)
+			log.Log.Fatalf("Error in configuration %s: %v", file, err)
+		}
 	}
 	if adapter.DatabaseConfig.TableName == "" {
 		adapter.DatabaseConfig.TableName = os.Getenv("ECOFLOW_DB_TABLENAME")
@@ -144,8 +179,136 @@ func evaluateConfig(file string) {
 
 }
 
+// validate check the configuration. The presets of the topics are applied
+// and the payload formats are compiled
+func (config *adapterConfig) validate() error {
+	err := config.DefaultConfig.Phases.validate()
+	if err != nil {
+		return fmt.Errorf("error in phase configuration: %v", err)
+	}
+	if config.Mqtt != nil {
+		for _, topic := range config.Mqtt.Topics {
+			err = topic.validateSubscription()
+			if err == nil {
+				err = topic.validateQueuePolicy()
+			}
+			if err != nil {
+				return fmt.Errorf("error in MQTT topic configuration: %v", err)
+			}
+		}
+	}
+	for _, topic := range config.topicMap() {
+		err = topic.applyPreset()
+		if err == nil {
+			err = topic.validateFormat()
+		}
+		if err != nil {
+			return fmt.Errorf("error in MQTT topic configuration: %v", err)
+		}
+	}
+	if config.DatabaseConfig != nil {
+		return config.DatabaseConfig.validate()
+	}
+	return nil
+}
+
+// validate check the database configuration
+func (dc *databaseConfig) validate() error {
+	if dc.Timescale != nil {
+		if err := dc.Timescale.validate(); err != nil {
+			return fmt.Errorf("error in timescale configuration: %v", err)
+		}
+	}
+	if dc.Rollup != nil {
+		if err := dc.Rollup.validate(); err != nil {
+			return fmt.Errorf("error in rollup configuration: %v", err)
+		}
+	}
+	if dc.Retention != nil {
+		if err := dc.Retention.validate(); err != nil {
+			return fmt.Errorf("error in retention configuration: %v", err)
+		}
+	}
+	if dc.LongFormat != nil {
+		if err := dc.LongFormat.validate(); err != nil {
+			return fmt.Errorf("error in long format configuration: %v", err)
+		}
+	}
+	for _, kf := range dc.KeyFilters {
+		if err := kf.validate(); err != nil {
+			return fmt.Errorf("error in key filter configuration: %v", err)
+		}
+	}
+	if dc.Deadband != nil {
+		if err := dc.Deadband.validate(); err != nil {
+			return fmt.Errorf("error in deadband configuration: %v", err)
+		}
+	}
+	return nil
+}
+
+// topicMap all MQTT topics and meter sources by name
+func (config *adapterConfig) topicMap() map[string]*Topic {
+	topicMap := make(map[string]*Topic)
+	if config.Mqtt != nil {
+		for _, topic := range config.Mqtt.Topics {
+			topicMap[topic.messageTopic()] = topic
+		}
+	}
+	for _, m := range config.meterSources() {
+		topicMap[m.topic().Name] = m.topic()
+	}
+	return topicMap
+}
+
 func watchConfig(s string, a any) error {
 	log.Log.Infof("Configuration file %s/%s changed, reload it", s, a.(string))
-	evaluateConfig(a.(string))
+	err := reloadConfig(a.(string))
+	if err != nil {
+		services.ServerMessage("Error reloading configuration, keep current configuration: %v", err)
+		log.Log.Errorf("Error reloading configuration %s: %v", a.(string), err)
+	}
+	return nil
+}
+
+// configLock protects the settings changed by a configuration reload
+var configLock sync.RWMutex
+
+// reloadConfig read the changed configuration file and validate it. The
+// running configuration is kept, only the key filters and the deadband are
+// taken over. All other changes need a restart
+func reloadConfig(file string) error {
+	data, err := readConfig(os.ExpandEnv(file))
+	if err != nil {
+		return err
+	}
+	config := &adapterConfig{DefaultConfig: &defaultConfig{}, DatabaseConfig: &databaseConfig{}}
+	err = yaml.Unmarshal(data, config)
+	if err != nil {
+		return fmt.Errorf("error unmarshal config %s: %v", file, err)
+	}
+	err = config.validate()
+	if err != nil {
+		return err
+	}
+	configLock.Lock()
+	defer configLock.Unlock()
+	adapter.DatabaseConfig.KeyFilters = config.DatabaseConfig.KeyFilters
+	adapter.DatabaseConfig.Deadband = config.DatabaseConfig.Deadband
+	services.ServerMessage("Configuration reloaded, key filters and deadband updated, other changes need a restart")
 	return nil
 }
+
+// keyFilters key filters of the running configuration
+func (dc *databaseConfig) keyFilters() []*keyFilter {
+	configLock.RLock()
+	defer configLock.RUnlock()
+	return dc.KeyFilters
+}
+
+// deadband deadband configuration of the running configuration
+func (dc *databaseConfig) deadband() *deadbandConfig {
+	configLock.RLock()
+	defer configLock.RUnlock()
+	return dc.Deadband
+}
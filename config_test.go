@@ -12,6 +12,8 @@
 package ecoflow2db
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -26,3 +28,42 @@ func TestAdapterLoad(t *testing.T) {
 	assert.Equal(t, []string([]string{"abc", "ddd", "${ECOFLOW_DEVICE_SN}"}),
 		adapter.EcoflowConfig.MicroConverter)
 }
+
+func TestConfigValidate(t *testing.T) {
+	assert.NoError(t, (&databaseConfig{}).validate())
+	assert.ErrorContains(t, (&databaseConfig{Deadband: &deadbandConfig{Default: -1}}).validate(), "deadband")
+	assert.ErrorContains(t, (&databaseConfig{LongFormat: &longFormatConfig{ViewMaxKeys: 2000}}).validate(),
+		"long format")
+	config := &adapterConfig{DefaultConfig: &defaultConfig{},
+		Mqtt: &mqttConfig{Topics: []*Topic{{Name: "meter", Format: "xml"}}}}
+	assert.ErrorContains(t, config.validate(), "MQTT topic")
+}
+
+func TestConfigReload(t *testing.T) {
+	old := adapter
+	defer func() { adapter = old }()
+	adapter = &adapterConfig{DefaultConfig: &defaultConfig{BaseRequest: 150},
+		DatabaseConfig: &databaseConfig{Table: "device_quota"}}
+	current, currentDefault := adapter, adapter.DefaultConfig
+	file := filepath.Join(t.TempDir(), "adapter.yaml")
+
+	// key filters and deadband are taken over by the running configuration
+	assert.NoError(t, os.WriteFile(file, []byte("default:\n  baseWatt: 200\n"+
+		"database:\n  keyFilters:\n    - exclude: [\"task*\"]\n  deadband:\n    tables: [\"*_mqtt\"]\n"), 0644))
+	assert.NoError(t, watchConfig(filepath.Dir(file), file))
+	assert.Same(t, current, adapter)
+	assert.Same(t, currentDefault, adapter.DefaultConfig)
+	assert.Equal(t, int64(150), adapter.DefaultConfig.BaseRequest)
+	assert.Equal(t, "device_quota", adapter.DatabaseConfig.Table)
+	if assert.Len(t, adapter.DatabaseConfig.keyFilters(), 1) {
+		assert.Equal(t, []string{"task*"}, adapter.DatabaseConfig.keyFilters()[0].Exclude)
+	}
+	assert.True(t, adapter.DatabaseConfig.deadband().match("r331_mqtt"))
+
+	// an invalid configuration is not used
+	assert.NoError(t, os.WriteFile(file, []byte("database:\n  deadband:\n    default: -1\n"), 0644))
+	assert.NoError(t, watchConfig(filepath.Dir(file), file))
+	assert.ErrorContains(t, reloadConfig(file), "deadband")
+	assert.True(t, adapter.DatabaseConfig.deadband().match("r331_mqtt"))
+	assert.Len(t, adapter.DatabaseConfig.keyFilters(), 1)
+}
@@ -14,7 +14,6 @@ package ecoflow2db
 import (
 	"fmt"
 	"os"
-	"runtime/debug"
 	"slices"
 	"strings"
 
@@ -63,6 +62,9 @@ func InitDatabase() {
 		log.Log.Fatalf("Register error log: %v", err)
 	}
 	readDatabaseMaps()
+	StartRollups()
+	StartPruning()
+	StartLongFormatViews()
 	go storeDatabase()
 }
 
@@ -88,78 +90,75 @@ func storeDatabase() {
 	storeid := connnectDatabase()
 	for m := range msgChan {
 		tn := strings.ToLower("mqtt_" + ecoflow.GetTypeName(m.object))
-		m.checkStoreElementTable(tn, storeid)
+		m.checkStoreElementTable(tn, &storeid)
 
 		log.Log.Debugf("Insert structFields: %T into tn", m.object)
 		fields := []string{"*"}
 		insert := &common.Entries{DataStruct: m.object,
 			Fields: fields}
 		insert.Values = [][]any{{m.object}}
-		_, err := storeid.Insert(tn, insert)
-		if err != nil {
-			services.ServerMessage("Error inserting record: %v", err)
-			// Reconnecting ...
-			storeid.Close()
-			storeid = connnectDatabase()
-			// log.Log.Fatal("Error inserting record: ", err)
-		} else {
-			getDbStatEntry(tn).counter++
-		}
-
+		// inserted by the writer to use the spool on errors
+		getWriter().writeEntries(tn, insert)
 	}
 }
 
 // checkTable check if table is available and if not, create it
-func (m *storeElement) checkStoreElementTable(tn string, storeid common.RegDbID) {
+func (m *storeElement) checkStoreElementTable(tn string, storeid *common.RegDbID) {
 	if tn == "" {
 		log.Log.Fatal("Check failed, database not given")
 	}
 	if !slices.Contains(dbTables, tn) {
 		services.ServerMessage("Database %s need to be created", tn)
-		err := storeid.CreateTable(tn, m.object)
+		err := schemaCall(storeid, func(id common.RegDbID) error {
+			return id.CreateTable(tn, m.object)
+		})
 		if err != nil {
 			log.Log.Fatal("Error creating database table: ", err)
 		}
 		readDatabaseMaps()
+		createHypertable(*storeid, tn)
+	}
+}
+
+// schemaCall run the schema operation with the handle. If the connection
+// is broken, the handle is reconnected and the operation is repeated once
+func schemaCall(id *common.RegDbID, f func(id common.RegDbID) error) error {
+	err := f(*id)
+	if err != nil && isTransientError(err) {
+		log.Log.Infof("Reconnect database handle after error: %v", err)
+		id.Close()
+		*id = connnectDatabase()
+		err = f(*id)
 	}
+	return err
 }
 
 // checkTable check table and if not available, create table
-func checkTable(storeid common.RegDbID, tn string, generateColumns func() []*common.Column) bool {
+func checkTable(storeid *common.RegDbID, tn string, generateColumns func() []*common.Column) bool {
 	if tn == "" {
 		log.Log.Fatal("Error check table, database not defined")
 	}
 	if !slices.Contains(dbTables, strings.ToLower(tn)) {
 		services.ServerMessage("Database check failed, %s need to be created", tn)
-		err := storeid.CreateTable(tn, generateColumns())
+		if isLongFormat(tn) {
+			generateColumns = longFormatColumns
+		}
+		columns := generateColumns()
+		err := schemaCall(storeid, func(id common.RegDbID) error {
+			return id.CreateTable(tn, columns)
+		})
 		if err != nil {
 			services.ServerMessage("Shuting down ... error creating database for %s : %v", tn, err)
 			log.Log.Fatal("Error creating database table: ", err)
 		}
 		readDatabaseMaps()
+		createHypertable(*storeid, tn)
 		return true
 	}
-	return false
-}
-
-// insertTable insert data into database
-func insertTable(storeid common.RegDbID, tn string, data map[string]interface{}, generateColumns func(map[string]interface{}) ([]string, [][]any)) error {
-	fields, values := generateColumns(data)
-	log.Log.Debugf("Insert columnFields: %#v", fields)
-	if len(fields) == 0 {
-		debug.PrintStack()
+	if isLongFormat(tn) {
+		checkLongFormatTable(storeid, tn)
 	}
-	insert := &common.Entries{
-		Values: values,
-		Fields: fields}
-	_, err := storeid.Insert(tn, insert)
-	if err != nil {
-		services.ServerMessage("Error inserting record: %v", err)
-		// log.Log.Fatal("Error inserting record: ", err)
-	} else {
-		getDbStatEntry(tn).counter++
-	}
-	return err
+	return false
 }
 
 // insertTable insert data into database
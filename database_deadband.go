@@ -0,0 +1,190 @@
+/*
+* Copyright 2025-2026 Thorsten A. Knieling
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*    http://www.apache.org/licenses/LICENSE-2.0
+*
+ */
+
+package ecoflow2db
+
+import (
+	"fmt"
+	"math"
+	"path"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultHeartbeatMinutes = 15
+
+// deadbandConfig change-only storage of the tables matching the patterns.
+// A row is only written if a value changes beyond the deadband of the field
+// or the heartbeat elapsed
+type deadbandConfig struct {
+	Tables           []string         `yaml:"tables"`
+	Default          float64          `yaml:"default"`
+	Fields           []*deadbandField `yaml:"fields"`
+	HeartbeatMinutes int              `yaml:"heartbeatMinutes"`
+}
+
+// deadbandField absolute deadband of the keys matching the pattern, the
+// first matching pattern is used
+type deadbandField struct {
+	Pattern  string  `yaml:"pattern"`
+	Deadband float64 `yaml:"deadband"`
+}
+
+// deadbandState last stored value of each key of a table and device, rows
+// containing only a subset of the keys are merged. Keys not stored within
+// the heartbeat are removed, a device no longer reporting a key does not
+// keep the stale value
+type deadbandState struct {
+	values  map[string]interface{}
+	seen    map[string]time.Time
+	written time.Time
+}
+
+var deadbandLock sync.Mutex
+var deadbandStates = make(map[string]*deadbandState)
+
+// validate check patterns and deadbands
+func (dc *deadbandConfig) validate() error {
+	for _, p := range dc.Tables {
+		if _, err := path.Match(strings.ToLower(p), ""); err != nil || p == "" {
+			return fmt.Errorf("invalid deadband table pattern '%s'", p)
+		}
+	}
+	if dc.Default < 0 {
+		return fmt.Errorf("deadband must not be negative")
+	}
+	for _, f := range dc.Fields {
+		if _, err := path.Match(f.Pattern, ""); err != nil || f.Pattern == "" {
+			return fmt.Errorf("invalid deadband field pattern '%s'", f.Pattern)
+		}
+		if f.Deadband < 0 {
+			return fmt.Errorf("deadband of %s must not be negative", f.Pattern)
+		}
+	}
+	return nil
+}
+
+// match check if the table uses change-only storage
+func (dc *deadbandConfig) match(tn string) bool {
+	if dc == nil {
+		return false
+	}
+	tn = strings.ToLower(tn)
+	for _, p := range dc.Tables {
+		if ok, _ := path.Match(strings.ToLower(p), tn); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// deadband deadband of the key
+func (dc *deadbandConfig) deadband(key string) float64 {
+	for _, f := range dc.Fields {
+		if ok, _ := path.Match(f.Pattern, key); ok {
+			return f.Deadband
+		}
+	}
+	return dc.Default
+}
+
+// expire remove keys not stored within the heartbeat
+func (state *deadbandState) expire(now time.Time, heartbeat time.Duration) {
+	for k, t := range state.seen {
+		if now.Sub(t) >= heartbeat {
+			delete(state.values, k)
+			delete(state.seen, k)
+		}
+	}
+}
+
+func (dc *deadbandConfig) heartbeat() time.Duration {
+	if dc.HeartbeatMinutes <= 0 {
+		return defaultHeartbeatMinutes * time.Minute
+	}
+	return time.Duration(dc.HeartbeatMinutes) * time.Minute
+}
+
+// changed check if a key of the data differs from the last stored value,
+// keys not part of the data are not compared
+func (dc *deadbandConfig) changed(last, data map[string]interface{}) bool {
+	for k, v := range data {
+		if k == "timestamp" {
+			continue
+		}
+		lv, ok := last[k]
+		if !ok {
+			return true
+		}
+		n, isNumber := v.(float64)
+		ln, lastNumber := lv.(float64)
+		if isNumber && lastNumber {
+			if math.Abs(n-ln) > dc.deadband(k) || (n != ln && dc.deadband(k) == 0) {
+				return true
+			}
+			continue
+		}
+		if !reflect.DeepEqual(v, lv) {
+			return true
+		}
+	}
+	return false
+}
+
+// storeRow check if the row of the table need to be stored, rows of
+// change-only tables are stored on change or heartbeat. The returned
+// function updates the state and need to be called after the row is
+// inserted, a failed insert does not suppress the next row. Rows inserted
+// late by the spool replay do not overwrite newer values
+func (dc *deadbandConfig) storeRow(tn string, data map[string]interface{}, now time.Time) (bool, func()) {
+	if !dc.match(tn) {
+		return true, nil
+	}
+	key := tn
+	if sn, ok := data["serial_number"].(string); ok {
+		key += "/" + sn
+	}
+	deadbandLock.Lock()
+	defer deadbandLock.Unlock()
+	state, ok := deadbandStates[key]
+	if ok {
+		state.expire(now, dc.heartbeat())
+	}
+	if ok && now.Sub(state.written) < dc.heartbeat() && !dc.changed(state.values, data) {
+		getDbStatEntry(tn).suppressed.Add(1)
+		return false, nil
+	}
+	values := make(map[string]interface{}, len(data))
+	for k, v := range data {
+		values[k] = v
+	}
+	return true, func() {
+		deadbandLock.Lock()
+		defer deadbandLock.Unlock()
+		state, ok := deadbandStates[key]
+		if !ok {
+			state = &deadbandState{values: make(map[string]interface{}), seen: make(map[string]time.Time)}
+			deadbandStates[key] = state
+		}
+		for k, v := range values {
+			if t, ok := state.seen[k]; ok && now.Before(t) {
+				continue
+			}
+			state.values[k] = v
+			state.seen[k] = now
+		}
+		if now.After(state.written) {
+			state.written = now
+		}
+	}
+}
@@ -0,0 +1,87 @@
+/*
+* Copyright 2025-2026 Thorsten A. Knieling
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*    http://www.apache.org/licenses/LICENSE-2.0
+*
+ */
+
+package ecoflow2db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeadband(t *testing.T) {
+	dc := &deadbandConfig{Tables: []string{"deadband_*"}, HeartbeatMinutes: 10,
+		Fields: []*deadbandField{{Pattern: "pd.watts*", Deadband: 5}}}
+	assert.NoError(t, dc.validate())
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	row := func(watts float64, mode string) map[string]interface{} {
+		return map[string]interface{}{"serial_number": "R331", "timestamp": now,
+			"pd.wattsOut": watts, "pd.mode": mode, "pd.soc": 80.0}
+	}
+	// the state is updated after the row is inserted
+	store := func(dc *deadbandConfig, tn string, data map[string]interface{}, now time.Time) bool {
+		ok, committed := dc.storeRow(tn, data, now)
+		if committed != nil {
+			committed()
+		}
+		return ok
+	}
+	assert.True(t, store(dc, "deadband_quota", row(100, "auto"), now))
+	// within deadband
+	assert.False(t, store(dc, "deadband_quota", row(104, "auto"), now.Add(time.Minute)))
+	assert.True(t, store(dc, "deadband_quota", row(106, "auto"), now.Add(2*time.Minute)))
+	assert.True(t, store(dc, "deadband_quota", row(106, "manual"), now.Add(3*time.Minute)))
+	// default deadband 0 for other numeric keys
+	r := row(106, "manual")
+	r["pd.soc"] = 81.0
+	assert.True(t, store(dc, "deadband_quota", r, now.Add(4*time.Minute)))
+	assert.False(t, store(dc, "deadband_quota", r, now.Add(5*time.Minute)))
+	// heartbeat
+	assert.True(t, store(dc, "deadband_quota", r, now.Add(15*time.Minute)))
+	// new key
+	r["pd.new"] = 1.0
+	assert.True(t, store(dc, "deadband_quota", r, now.Add(16*time.Minute)))
+	assert.True(t, store(dc, "device_quota", row(100, "auto"), now))
+	assert.True(t, store(dc, "device_quota", row(100, "auto"), now))
+	assert.Equal(t, uint64(2), getDbStatEntry("deadband_quota").suppressed.Load())
+
+	// rows with a subset of the keys are compared to the merged state
+	dc.Tables = append(dc.Tables, "subset_*")
+	assert.True(t, store(dc, "subset_mqtt", map[string]interface{}{"pd.wattsOut": 100.0, "pd.mode": "auto"}, now))
+	assert.False(t, store(dc, "subset_mqtt", map[string]interface{}{"pd.wattsOut": 102.0}, now.Add(time.Second)))
+	assert.False(t, store(dc, "subset_mqtt", map[string]interface{}{"pd.mode": "auto"}, now.Add(2*time.Second)))
+	assert.True(t, store(dc, "subset_mqtt", map[string]interface{}{"pd.soc": 80.0}, now.Add(3*time.Second)))
+	assert.False(t, store(dc, "subset_mqtt", map[string]interface{}{"pd.soc": 80.0, "pd.mode": "auto"}, now.Add(4*time.Second)))
+
+	// a failed insert does not suppress the next row
+	ok, _ := dc.storeRow("subset_mqtt", map[string]interface{}{"pd.mode": "manual"}, now.Add(5*time.Second))
+	assert.True(t, ok)
+	assert.True(t, store(dc, "subset_mqtt", map[string]interface{}{"pd.mode": "manual"}, now.Add(6*time.Second)))
+	assert.False(t, store(dc, "subset_mqtt", map[string]interface{}{"pd.mode": "manual"}, now.Add(7*time.Second)))
+
+	// keys not stored within the heartbeat are not kept in the state
+	dc.Tables = append(dc.Tables, "stale_*")
+	assert.True(t, store(dc, "stale_mqtt", map[string]interface{}{"pd.x": 1.0}, now))
+	assert.True(t, store(dc, "stale_mqtt", map[string]interface{}{"pd.y": 1.0}, now.Add(time.Second)))
+	assert.True(t, store(dc, "stale_mqtt", map[string]interface{}{"pd.y": 1.0}, now.Add(11*time.Minute)))
+	assert.True(t, store(dc, "stale_mqtt", map[string]interface{}{"pd.x": 1.0}, now.Add(12*time.Minute)))
+	assert.False(t, store(dc, "stale_mqtt", map[string]interface{}{"pd.x": 1.0}, now.Add(13*time.Minute)))
+
+	// a row replayed late does not overwrite newer values
+	_, late := dc.storeRow("stale_mqtt", map[string]interface{}{"pd.x": 2.0}, now.Add(14*time.Minute))
+	assert.True(t, store(dc, "stale_mqtt", map[string]interface{}{"pd.x": 3.0}, now.Add(15*time.Minute)))
+	late()
+	assert.False(t, store(dc, "stale_mqtt", map[string]interface{}{"pd.x": 3.0}, now.Add(16*time.Minute)))
+
+	assert.True(t, store((*deadbandConfig)(nil), "deadband_quota", row(100, "auto"), now))
+	assert.Error(t, (&deadbandConfig{Fields: []*deadbandField{{Pattern: "x", Deadband: -1}}}).validate())
+}
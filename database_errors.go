@@ -0,0 +1,54 @@
+/*
+* Copyright 2025-2026 Thorsten A. Knieling
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*    http://www.apache.org/licenses/LICENSE-2.0
+*
+ */
+
+package ecoflow2db
+
+import (
+	"errors"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// isTransientError check if the database error is caused by the connection
+// or the server state and the insert can be retried later. Errors the
+// database returns for the data itself, like invalid values, too long values
+// or constraint violations, are not transient
+func isTransientError(err error) bool {
+	if err == nil {
+		return false
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		if len(pgErr.Code) < 2 {
+			return true
+		}
+		switch pgErr.Code[:2] {
+		case "08", "40", "53", "57", "58":
+			// connection, transaction rollback, resources, operator
+			// intervention and system errors
+			return true
+		}
+		return false
+	}
+	var myErr *mysql.MySQLError
+	if errors.As(err, &myErr) {
+		switch myErr.Number {
+		case 1040, 1053, 1205, 1213, 1317:
+			// too many connections, shutdown, lock timeout, deadlock
+			// and interrupted query
+			return true
+		}
+		return false
+	}
+	// network and driver errors
+	return true
+}
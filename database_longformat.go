@@ -0,0 +1,393 @@
+/*
+* Copyright 2025-2026 Thorsten A. Knieling
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*    http://www.apache.org/licenses/LICENSE-2.0
+*
+ */
+
+package ecoflow2db
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tknie/flynn/common"
+	"github.com/tknie/log"
+	"github.com/tknie/services"
+)
+
+const defaultViewRefreshMinutes = 5
+
+// maxViewColumns Postgres allows 1600 columns, two are used for the
+// timestamp and the serial number
+const maxViewColumns = 1598
+
+var longFormatFields = []string{"eco_timestamp", "eco_serial", "eco_key", "eco_numeric_value", "eco_text_value"}
+
+// longFormatConfig tables stored as one row per key instead of one column
+// per key. A materialized wide view <table>_wide is provided for Grafana
+type longFormatConfig struct {
+	Tables             []string `yaml:"tables"`
+	ViewRefreshMinutes int      `yaml:"viewRefreshMinutes"`
+	ViewMaxKeys        int      `yaml:"viewMaxKeys"`
+}
+
+// wideKey key of a long format table, text keys are shown with their text
+// value in the wide view
+type wideKey struct {
+	key  string
+	text bool
+}
+
+// knownKeys keys inserted into the long format tables, a table is marked
+// changed if a new key or the first text value of a key is inserted
+type knownKeys struct {
+	lock    sync.Mutex
+	keys    map[string]map[string]bool
+	changed map[string]bool
+}
+
+var longFormatKeys = &knownKeys{keys: make(map[string]map[string]bool), changed: make(map[string]bool)}
+
+// wideFormatTables tables matching the long format configuration which
+// exist with one column per key, they are kept in wide format
+var wideFormatTables sync.Map
+
+// longFormatChecked existing tables checked for the long format columns
+var longFormatChecked sync.Map
+
+// add record the keys of inserted rows, text is true for text values
+func (kk *knownKeys) add(tn string, key string, text bool) {
+	kk.lock.Lock()
+	defer kk.lock.Unlock()
+	keys, ok := kk.keys[tn]
+	if !ok {
+		keys = make(map[string]bool)
+		kk.keys[tn] = keys
+	}
+	if t, ok := keys[key]; !ok || (text && !t) {
+		keys[key] = text
+		kk.changed[tn] = true
+	}
+}
+
+// take copy of the known keys of the table and if new keys are inserted
+// since the last call
+func (kk *knownKeys) take(tn string) ([]wideKey, bool) {
+	kk.lock.Lock()
+	defer kk.lock.Unlock()
+	changed := kk.changed[tn]
+	delete(kk.changed, tn)
+	keys := make([]wideKey, 0, len(kk.keys[tn]))
+	for k, text := range kk.keys[tn] {
+		keys = append(keys, wideKey{key: k, text: text})
+	}
+	return keys, changed
+}
+
+// mergeKeys union of the keys sorted by key, a key is a text key if it is
+// a text key in one of the lists
+func mergeKeys(a, b []wideKey) []wideKey {
+	text := make(map[string]bool, len(a)+len(b))
+	for _, k := range slices.Concat(a, b) {
+		text[k.key] = text[k.key] || k.text
+	}
+	keys := make([]wideKey, 0, len(text))
+	for k, t := range text {
+		keys = append(keys, wideKey{key: k, text: t})
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].key < keys[j].key })
+	return keys
+}
+
+// validate check the table patterns
+func (lc *longFormatConfig) validate() error {
+	for _, p := range lc.Tables {
+		if _, err := path.Match(strings.ToLower(p), ""); err != nil || p == "" {
+			return fmt.Errorf("invalid long format table pattern '%s'", p)
+		}
+	}
+	if lc.ViewMaxKeys < 0 || lc.ViewMaxKeys > maxViewColumns {
+		return fmt.Errorf("wide view keys must be between 1 and %d", maxViewColumns)
+	}
+	return nil
+}
+
+// viewMaxKeys maximum keys shown as columns in the wide view
+func (lc *longFormatConfig) viewMaxKeys() int {
+	if lc.ViewMaxKeys <= 0 {
+		return maxViewColumns
+	}
+	return lc.ViewMaxKeys
+}
+
+// match check if the table is stored in long format
+func (lc *longFormatConfig) match(tn string) bool {
+	if lc == nil {
+		return false
+	}
+	tn = strings.ToLower(tn)
+	for _, p := range lc.Tables {
+		if ok, _ := path.Match(strings.ToLower(p), tn); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (lc *longFormatConfig) interval() time.Duration {
+	if lc.ViewRefreshMinutes <= 0 {
+		return defaultViewRefreshMinutes * time.Minute
+	}
+	return time.Duration(lc.ViewRefreshMinutes) * time.Minute
+}
+
+// isLongFormat check if the table is configured to be stored in long format
+// and not an existing wide format table
+func isLongFormat(tn string) bool {
+	if _, ok := wideFormatTables.Load(strings.ToLower(tn)); ok {
+		return false
+	}
+	return adapter.DatabaseConfig != nil && adapter.DatabaseConfig.LongFormat.match(tn)
+}
+
+// hasLongFormatColumns check if the columns of the table are the long
+// format columns
+func hasLongFormatColumns(columns []string) bool {
+	return slices.Contains(columns, "eco_key") && slices.Contains(columns, "eco_numeric_value")
+}
+
+// checkLongFormatTable check once if the existing table has the long format
+// columns. Tables created with one column per key before the long format is
+// configured are kept in wide format
+func checkLongFormatTable(storeid *common.RegDbID, tn string) {
+	tn = strings.ToLower(tn)
+	if _, ok := longFormatChecked.Load(tn); ok {
+		return
+	}
+	var col []string
+	err := schemaCall(storeid, func(id common.RegDbID) (err error) {
+		col, err = id.GetTableColumn(tn)
+		return err
+	})
+	if err != nil {
+		services.ServerMessage("Get table column %v", err)
+		return
+	}
+	longFormatChecked.Store(tn, true)
+	if !hasLongFormatColumns(col) {
+		services.ServerMessage("Table %s exists in wide format, long format is not used for it; "+
+			"rename or drop the table to store it in long format", tn)
+		wideFormatTables.Store(tn, true)
+	}
+}
+
+// longFormatColumns columns of a long format table
+func longFormatColumns() []*common.Column {
+	return []*common.Column{
+		{Name: "eco_timestamp", DataType: common.CurrentTimestamp, Length: 8},
+		{Name: "eco_serial", DataType: common.Alpha, Length: 64},
+		{Name: "eco_key", DataType: common.Alpha, Length: 255},
+		{Name: "eco_numeric_value", DataType: common.Decimal, Length: 20, Digits: 5},
+		{Name: "eco_text_value", DataType: common.Text},
+	}
+}
+
+// longFormatRows generate one row per key. The serial number is taken of the
+// data or of the <sn>_mqtt table name
+func longFormatRows(tn string, data map[string]interface{}) ([]string, [][]any) {
+	ts := time.Now()
+	if t, ok := data["timestamp"].(time.Time); ok {
+		ts = t
+	}
+	serial, ok := data["serial_number"].(string)
+	if !ok {
+		serial = strings.TrimSuffix(tn, "_mqtt")
+	}
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		if k != "timestamp" && k != "serial_number" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	rows := make([][]any, 0, len(keys))
+	ltn := strings.ToLower(tn)
+	for _, k := range keys {
+		var numeric, text any
+		switch val := data[k].(type) {
+		case float64:
+			numeric = val
+		case int64:
+			numeric = float64(val)
+		case bool:
+			numeric = 0.0
+			if val {
+				numeric = 1.0
+			}
+		case string:
+			text = val
+		case time.Time:
+			text = val.Format(time.RFC3339Nano)
+		case []interface{}, map[string]interface{}:
+			b, err := json.Marshal(val)
+			if err != nil {
+				services.ServerMessage("Error marshal: %#v", val)
+				continue
+			}
+			text = string(b)
+		default:
+			log.Log.Errorf("Unknown type %s=%T", k, val)
+			continue
+		}
+		longFormatKeys.add(ltn, k, text != nil)
+		rows = append(rows, []any{ts, serial, k, numeric, text})
+	}
+	return longFormatFields, rows
+}
+
+// wideViewStatement statement creating the materialized wide view with one
+// column per key. The view is limited to maxKeys columns, the number of
+// keys not shown is returned
+func wideViewStatement(tn string, keys []wideKey, maxKeys int) (string, int) {
+	tn = strings.ToLower(tn)
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("CREATE MATERIALIZED VIEW %s_wide AS SELECT eco_timestamp, eco_serial", tn))
+	columns := 0
+	omitted := 0
+	for _, k := range keys {
+		name := columnName(k.key)
+		if !identifierRegexp.MatchString(name) {
+			log.Log.Debugf("Key %s cannot be used as view column", k.key)
+			continue
+		}
+		if columns >= maxKeys {
+			omitted++
+			continue
+		}
+		columns++
+		value := "eco_numeric_value"
+		if k.text {
+			value = "eco_text_value"
+		}
+		sb.WriteString(fmt.Sprintf(", max(%s) FILTER (WHERE eco_key = '%s') AS %s",
+			value, strings.ReplaceAll(k.key, "'", "''"), name))
+	}
+	sb.WriteString(fmt.Sprintf(" FROM %s GROUP BY eco_timestamp, eco_serial", tn))
+	return sb.String(), omitted
+}
+
+// wideViewIndexStatement unique index of the wide view needed to refresh
+// the view concurrently
+func wideViewIndexStatement(tn string) string {
+	tn = strings.ToLower(tn)
+	return fmt.Sprintf("CREATE UNIQUE INDEX IF NOT EXISTS %s_wide_key ON %s_wide (eco_timestamp, eco_serial)", tn, tn)
+}
+
+// StartLongFormatViews start the loop keeping the wide views of the long
+// format tables in step
+func StartLongFormatViews() {
+	if adapter.DatabaseConfig == nil || adapter.DatabaseConfig.LongFormat == nil ||
+		len(adapter.DatabaseConfig.LongFormat.Tables) == 0 {
+		return
+	}
+	if dbRef == nil || dbRef.Driver != common.PostgresType {
+		services.ServerMessage("Wide views of long format tables need a Postgres database")
+		return
+	}
+	lc := adapter.DatabaseConfig.LongFormat
+	go func() {
+		viewKeys := make(map[string][]wideKey)
+		refreshWideViews(lc, viewKeys)
+		ticker := time.NewTicker(lc.interval())
+		for {
+			select {
+			case <-ticker.C:
+				refreshWideViews(lc, viewKeys)
+			case <-quit:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+}
+
+// selectKeys read all keys stored in the long format table
+func selectKeys(id common.RegDbID, tn string) ([]wideKey, error) {
+	rows, err := id.BatchSelect(fmt.Sprintf("SELECT eco_key, bool_or(eco_text_value IS NOT NULL) FROM %s GROUP BY eco_key", tn))
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]wideKey, 0, len(rows))
+	for _, r := range rows {
+		if len(r) < 2 {
+			continue
+		}
+		text, _ := r[1].(bool)
+		keys = append(keys, wideKey{key: schemaString(r[0]), text: text})
+	}
+	return keys, nil
+}
+
+// refreshWideViews refresh the wide views concurrently. The keys of a table
+// are read once, afterwards the view is created again only if new keys are
+// inserted
+func refreshWideViews(lc *longFormatConfig, viewKeys map[string][]wideKey) {
+	id := connnectDatabase()
+	defer id.Close()
+	readDatabaseMaps()
+	for _, tn := range slices.Clone(dbTables) {
+		if !lc.match(tn) || !isLongFormat(tn) || strings.HasSuffix(tn, "_wide") {
+			continue
+		}
+		known, changed := longFormatKeys.take(tn)
+		current, ok := viewKeys[tn]
+		keys := current
+		if !ok {
+			stored, err := selectKeys(id, tn)
+			if err != nil {
+				log.Log.Errorf("Error reading keys of %s: %v", tn, err)
+				continue
+			}
+			keys = stored
+		}
+		var err error
+		if changed || !ok {
+			keys = mergeKeys(keys, known)
+		}
+		if ok && slices.Equal(current, keys) {
+			err = id.Batch(fmt.Sprintf("REFRESH MATERIALIZED VIEW CONCURRENTLY %s_wide", tn))
+		} else {
+			err = id.Batch(fmt.Sprintf("DROP MATERIALIZED VIEW IF EXISTS %s_wide", tn))
+			if err == nil {
+				statement, omitted := wideViewStatement(tn, keys, lc.viewMaxKeys())
+				if omitted > 0 {
+					services.ServerMessage("Wide view %s_wide exceeds %d columns, %d of %d keys are not shown; "+
+						"reduce the keys with key filters", tn, lc.viewMaxKeys(), omitted, len(keys))
+				}
+				err = id.Batch(statement)
+			}
+			if err == nil {
+				err = id.Batch(wideViewIndexStatement(tn))
+			}
+			if err == nil {
+				services.ServerMessage("Wide view %s_wide created with %d keys", tn, len(keys))
+				viewKeys[tn] = keys
+			}
+		}
+		if err != nil {
+			services.ServerMessage("Error refreshing wide view of %s: %v", tn, err)
+			delete(viewKeys, tn)
+		}
+	}
+}
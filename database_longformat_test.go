@@ -0,0 +1,87 @@
+/*
+* Copyright 2025-2026 Thorsten A. Knieling
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*    http://www.apache.org/licenses/LICENSE-2.0
+*
+ */
+
+package ecoflow2db
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tknie/flynn/common"
+)
+
+func TestLongFormat(t *testing.T) {
+	lc := &longFormatConfig{Tables: []string{"*_mqtt"}}
+	assert.NoError(t, lc.validate())
+	assert.True(t, lc.match("R331ZEB4ZEA0012_mqtt"))
+	assert.False(t, lc.match("device_quota"))
+	assert.False(t, (*longFormatConfig)(nil).match("x_mqtt"))
+	assert.Error(t, (&longFormatConfig{Tables: []string{"["}}).validate())
+
+	ts := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	fields, rows := longFormatRows("R331_mqtt", map[string]interface{}{"timestamp": ts,
+		"pd.watts": 12.5, "pd.mode": "auto", "bms.cells": []interface{}{1.0, 2.0}, "pd.on": true})
+	assert.Equal(t, longFormatFields, fields)
+	assert.Equal(t, [][]any{
+		{ts, "R331", "bms.cells", nil, "[1,2]"},
+		{ts, "R331", "pd.mode", nil, "auto"},
+		{ts, "R331", "pd.on", 1.0, nil},
+		{ts, "R331", "pd.watts", 12.5, nil},
+	}, rows)
+	_, rows = longFormatRows("device_quota", map[string]interface{}{"serial_number": "HW51", "soc": 80.0})
+	assert.Equal(t, "HW51", rows[0][1])
+
+	keys := []wideKey{{key: "pd.mode", text: true}, {key: "pd.watts"}, {key: "bad key'"}}
+	statement, omitted := wideViewStatement("R331_mqtt", keys, lc.viewMaxKeys())
+	assert.Equal(t, "CREATE MATERIALIZED VIEW r331_mqtt_wide AS SELECT eco_timestamp, eco_serial, "+
+		"max(eco_text_value) FILTER (WHERE eco_key = 'pd.mode') AS eco_pd_mode, "+
+		"max(eco_numeric_value) FILTER (WHERE eco_key = 'pd.watts') AS eco_pd_watts "+
+		"FROM r331_mqtt GROUP BY eco_timestamp, eco_serial", statement)
+	assert.Equal(t, 0, omitted)
+
+	// the view is capped below the Postgres column limit
+	many := make([]wideKey, 0, 2000)
+	for i := 0; i < 2000; i++ {
+		many = append(many, wideKey{key: fmt.Sprintf("key%04d", i)})
+	}
+	statement, omitted = wideViewStatement("R331_mqtt", many, lc.viewMaxKeys())
+	assert.Equal(t, 2000-maxViewColumns, omitted)
+	assert.Equal(t, maxViewColumns, strings.Count(statement, " AS eco_key"))
+	assert.Error(t, (&longFormatConfig{ViewMaxKeys: 1600}).validate())
+
+	assert.Equal(t, "CREATE UNIQUE INDEX IF NOT EXISTS r331_mqtt_wide_key ON r331_mqtt_wide (eco_timestamp, eco_serial)",
+		wideViewIndexStatement("R331_mqtt"))
+	assert.True(t, hasLongFormatColumns([]string{"eco_timestamp", "eco_serial", "eco_key", "eco_numeric_value"}))
+	assert.False(t, hasLongFormatColumns([]string{"eco_timestamp", "eco_pd_watts"}))
+
+	// new keys and keys getting text values mark the table changed
+	known, changed := longFormatKeys.take("r331_mqtt")
+	assert.True(t, changed)
+	assert.Len(t, known, 4)
+	longFormatRows("R331_mqtt", map[string]interface{}{"timestamp": ts, "pd.watts": 13.0})
+	_, changed = longFormatKeys.take("r331_mqtt")
+	assert.False(t, changed)
+	longFormatRows("R331_mqtt", map[string]interface{}{"timestamp": ts, "pd.watts": "n/a", "pd.new": 1.0})
+	known, changed = longFormatKeys.take("r331_mqtt")
+	assert.True(t, changed)
+	assert.Equal(t, []wideKey{{key: "bms.cells", text: true}, {key: "pd.mode", text: true}, {key: "pd.new"},
+		{key: "pd.on"}, {key: "pd.watts", text: true}, {key: "pd.x"}},
+		mergeKeys([]wideKey{{key: "pd.x"}, {key: "pd.watts"}}, known))
+
+	for _, c := range longFormatColumns() {
+		if c.Name == "eco_text_value" {
+			assert.Equal(t, common.Text, c.DataType)
+		}
+	}
+}
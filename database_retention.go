@@ -0,0 +1,235 @@
+/*
+* Copyright 2025-2026 Thorsten A. Knieling
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*    http://www.apache.org/licenses/LICENSE-2.0
+*
+ */
+
+package ecoflow2db
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/tknie/flynn/common"
+	"github.com/tknie/log"
+	"github.com/tknie/services"
+)
+
+const defaultPruneMinutes = 60
+const defaultPruneBatchSize = 1000
+
+// retentionConfig retention rules and pruning job configuration
+type retentionConfig struct {
+	IntervalMinutes int              `yaml:"intervalMinutes"`
+	BatchSize       int              `yaml:"batchSize"`
+	PauseMs         int              `yaml:"pauseMs"`
+	Rules           []*retentionRule `yaml:"rules"`
+}
+
+// retentionRule keep the rows of all tables matching the pattern for the
+// given days, 0 days keeps the rows forever. The first matching rule is used
+type retentionRule struct {
+	Pattern    string `yaml:"pattern"`
+	Days       int    `yaml:"days"`
+	TimeColumn string `yaml:"timeColumn"`
+}
+
+// validate check patterns and time columns of the rules
+func (rc *retentionConfig) validate() error {
+	for _, r := range rc.Rules {
+		if _, err := path.Match(strings.ToLower(r.Pattern), ""); err != nil || r.Pattern == "" {
+			return fmt.Errorf("invalid retention pattern '%s'", r.Pattern)
+		}
+		if r.Days < 0 {
+			return fmt.Errorf("retention days of %s must not be negative", r.Pattern)
+		}
+		if !identifierRegexp.MatchString(r.timeColumn()) {
+			return fmt.Errorf("invalid retention time column %s", r.TimeColumn)
+		}
+	}
+	return nil
+}
+
+// rule first retention rule matching the table, nil if the table is kept
+func (rc *retentionConfig) rule(tn string) *retentionRule {
+	tn = strings.ToLower(tn)
+	for _, r := range rc.Rules {
+		if ok, _ := path.Match(strings.ToLower(r.Pattern), tn); ok {
+			if r.Days == 0 {
+				return nil
+			}
+			return r
+		}
+	}
+	return nil
+}
+
+func (rc *retentionConfig) interval() time.Duration {
+	if rc.IntervalMinutes <= 0 {
+		return defaultPruneMinutes * time.Minute
+	}
+	return time.Duration(rc.IntervalMinutes) * time.Minute
+}
+
+func (rc *retentionConfig) batchSize() int {
+	if rc.BatchSize <= 0 {
+		return defaultPruneBatchSize
+	}
+	return rc.BatchSize
+}
+
+// timeColumn time column compared with the retention cutoff
+func (r *retentionRule) timeColumn() string {
+	if r.TimeColumn == "" {
+		return defaultTimescaleColumn
+	}
+	return strings.ToLower(r.TimeColumn)
+}
+
+// pruneStatement statement deleting one batch of rows older than cutoff,
+// returning the number of deleted rows. The batch is the time range up to
+// the timestamp of the batchSize oldest row
+func (r *retentionRule) pruneStatement(tn string, cutoff time.Time, batchSize int) string {
+	tn = strings.ToLower(tn)
+	tc := r.timeColumn()
+	c := cutoff.UTC().Format(time.RFC3339Nano)
+	return fmt.Sprintf("WITH b AS (SELECT max(%s) AS upper FROM (SELECT %s FROM %s WHERE %s < '%s'::timestamptz "+
+		"ORDER BY %s LIMIT %d) s), d AS (DELETE FROM %s WHERE %s < '%s'::timestamptz AND %s <= (SELECT upper FROM b) "+
+		"RETURNING 1) SELECT count(*) FROM d", tc, tc, tn, tc, c, tc, batchSize, tn, tc, c, tc)
+}
+
+// hypertableStatements statements counting the rows of the chunks older
+// than cutoff and dropping these chunks
+func (r *retentionRule) hypertableStatements(tn string, cutoff time.Time) (string, string) {
+	tn = strings.ToLower(tn)
+	c := cutoff.UTC().Format(time.RFC3339Nano)
+	count := fmt.Sprintf("SELECT count(*) FROM %s WHERE %s < (SELECT max(range_end) FROM timescaledb_information.chunks "+
+		"WHERE hypertable_name = '%s' AND range_end <= '%s'::timestamptz)", tn, r.timeColumn(), tn, c)
+	drop := fmt.Sprintf("SELECT drop_chunks('%s', older_than => '%s'::timestamptz)", tn, c)
+	return count, drop
+}
+
+// hypertableColumn time dimension column if the table is a hypertable
+func hypertableColumn(id common.RegDbID, tn string) string {
+	if !checkTimescale(id) {
+		return ""
+	}
+	rows, err := id.BatchSelect(fmt.Sprintf("SELECT column_name FROM timescaledb_information.dimensions "+
+		"WHERE hypertable_name = '%s' AND dimension_number = 1", strings.ToLower(tn)))
+	if err != nil || len(rows) == 0 || len(rows[0]) == 0 {
+		return ""
+	}
+	return schemaString(rows[0][0])
+}
+
+// StartPruning start the scheduled pruning job
+func StartPruning() {
+	if adapter.DatabaseConfig == nil || adapter.DatabaseConfig.Retention == nil ||
+		len(adapter.DatabaseConfig.Retention.Rules) == 0 {
+		return
+	}
+	if dbRef == nil || dbRef.Driver != common.PostgresType {
+		services.ServerMessage("Retention pruning needs a Postgres database, pruning disabled")
+		return
+	}
+	rc := adapter.DatabaseConfig.Retention
+	go func() {
+		ticker := time.NewTicker(rc.interval())
+		pruneTables(rc)
+		for {
+			select {
+			case <-ticker.C:
+				pruneTables(rc)
+			case <-quit:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+}
+
+// pruneTables delete outdated rows of all tables with retention rule
+func pruneTables(rc *retentionConfig) {
+	id := connnectDatabase()
+	defer id.Close()
+	readDatabaseMaps()
+	for _, tn := range slices.Clone(dbTables) {
+		r := rc.rule(tn)
+		if r == nil {
+			continue
+		}
+		columns, err := id.GetTableColumn(tn)
+		if err != nil || !slices.Contains(columns, r.timeColumn()) {
+			log.Log.Debugf("Table %s has no time column %s, not pruned", tn, r.timeColumn())
+			continue
+		}
+		cutoff := time.Now().AddDate(0, 0, -r.Days)
+		var deleted uint64
+		if hypertableColumn(id, tn) == r.timeColumn() {
+			deleted, err = dropChunks(id, tn, r, cutoff)
+		} else {
+			deleted, err = pruneTable(id, tn, r, cutoff, rc.batchSize(), time.Duration(rc.PauseMs)*time.Millisecond)
+		}
+		if err != nil {
+			services.ServerMessage("Error pruning table %s: %v", tn, err)
+		}
+		if deleted > 0 {
+			log.Log.Infof("Pruned %d records of %s older than %v", deleted, tn, cutoff)
+		}
+	}
+}
+
+// dropChunks drop all chunks of the hypertable older than cutoff
+func dropChunks(id common.RegDbID, tn string, r *retentionRule, cutoff time.Time) (uint64, error) {
+	count, drop := r.hypertableStatements(tn, cutoff)
+	rows, err := id.BatchSelect(count)
+	if err != nil {
+		return 0, err
+	}
+	deleted := uint64(0)
+	if len(rows) > 0 && len(rows[0]) > 0 {
+		deleted = uint64(resultInt64(rows[0][0]))
+	}
+	_, err = id.BatchSelect(drop)
+	if err != nil {
+		return 0, err
+	}
+	getDbStatEntry(tn).pruned.Add(deleted)
+	return deleted, nil
+}
+
+// pruneTable delete rows older than cutoff in small batches until no
+// outdated row is left
+func pruneTable(id common.RegDbID, tn string, r *retentionRule, cutoff time.Time,
+	batchSize int, pause time.Duration) (uint64, error) {
+	stat := getDbStatEntry(tn)
+	deleted := uint64(0)
+	for {
+		rows, err := id.BatchSelect(r.pruneStatement(tn, cutoff, batchSize))
+		if err != nil {
+			return deleted, err
+		}
+		count := uint64(0)
+		if len(rows) > 0 && len(rows[0]) > 0 {
+			count = uint64(resultInt64(rows[0][0]))
+		}
+		deleted += count
+		stat.pruned.Add(count)
+		if count < uint64(batchSize) {
+			return deleted, nil
+		}
+		select {
+		case <-quit:
+			return deleted, nil
+		case <-time.After(pause):
+		}
+	}
+}
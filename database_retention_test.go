@@ -0,0 +1,58 @@
+/*
+* Copyright 2025-2026 Thorsten A. Knieling
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*    http://www.apache.org/licenses/LICENSE-2.0
+*
+ */
+
+package ecoflow2db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetentionRules(t *testing.T) {
+	rc := &retentionConfig{Rules: []*retentionRule{
+		{Pattern: "*_1[mhd]", Days: 0},
+		{Pattern: "device_quota", Days: 90},
+		{Pattern: "*_mqtt", Days: 30, TimeColumn: "eco_time"},
+		{Pattern: "mqtt_*", Days: 7},
+	}}
+	assert.NoError(t, rc.validate())
+	assert.Nil(t, rc.rule("device_quota_1h"))
+	assert.Nil(t, rc.rule("ecoflow"))
+	assert.Equal(t, 90, rc.rule("Device_Quota").Days)
+	assert.Equal(t, 30, rc.rule("hw51abc_mqtt").Days)
+	assert.Equal(t, 7, rc.rule("mqtt_heartbeat").Days)
+	assert.Equal(t, defaultPruneBatchSize, rc.batchSize())
+
+	cutoff := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	prune := rc.rule("hw51abc_mqtt").pruneStatement("HW51ABC_mqtt", cutoff, 500)
+	assert.Equal(t, "WITH b AS (SELECT max(eco_time) AS upper FROM (SELECT eco_time FROM hw51abc_mqtt "+
+		"WHERE eco_time < '2025-03-01T00:00:00Z'::timestamptz ORDER BY eco_time LIMIT 500) s), "+
+		"d AS (DELETE FROM hw51abc_mqtt WHERE eco_time < '2025-03-01T00:00:00Z'::timestamptz "+
+		"AND eco_time <= (SELECT upper FROM b) RETURNING 1) SELECT count(*) FROM d", prune)
+	assert.NotContains(t, prune, "ctid")
+
+	// hypertables drop whole chunks, ctid is only unique within a chunk
+	count, drop := rc.rule("device_quota").hypertableStatements("Device_Quota", cutoff)
+	assert.Equal(t, "SELECT count(*) FROM device_quota WHERE eco_timestamp < (SELECT max(range_end) "+
+		"FROM timescaledb_information.chunks WHERE hypertable_name = 'device_quota' "+
+		"AND range_end <= '2025-03-01T00:00:00Z'::timestamptz)", count)
+	assert.Equal(t, "SELECT drop_chunks('device_quota', older_than => '2025-03-01T00:00:00Z'::timestamptz)", drop)
+	assert.NotContains(t, count+drop, "ctid")
+
+	assert.Error(t, (&retentionConfig{Rules: []*retentionRule{{Pattern: "[", Days: 1}}}).validate())
+	assert.Error(t, (&retentionConfig{Rules: []*retentionRule{{Pattern: "x", Days: -1}}}).validate())
+
+	sd := &statDatabase{}
+	sd.pruned.Add(12)
+	assert.Equal(t, "inserted 000 records pruned 012 records", sd.String())
+}
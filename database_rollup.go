@@ -0,0 +1,353 @@
+/*
+* Copyright 2025-2026 Thorsten A. Knieling
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*    http://www.apache.org/licenses/LICENSE-2.0
+*
+ */
+
+package ecoflow2db
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/tknie/flynn/common"
+	"github.com/tknie/log"
+	"github.com/tknie/services"
+)
+
+const defaultRollupSeconds = 60
+
+// rollupWindowSize maximum time range aggregated by one statement
+const rollupWindowSize = 24 * time.Hour
+
+// rollupLevel aggregation level with the Postgres date_trunc unit and the
+// suffix of the rollup table
+type rollupLevel struct {
+	unit   string
+	suffix string
+}
+
+var rollupLevels = []rollupLevel{{"minute", "1m"}, {"hour", "1h"}, {"day", "1d"}}
+
+var rollupAggregates = []string{"avg", "min", "max", "last"}
+
+// rollupConfig aggregate tables kept in step with the raw tables
+type rollupConfig struct {
+	IntervalSeconds int            `yaml:"intervalSeconds"`
+	Tables          []*rollupTable `yaml:"tables"`
+}
+
+// rollupTable numeric columns of a raw table to be aggregated
+type rollupTable struct {
+	Table      string   `yaml:"table"`
+	TimeColumn string   `yaml:"timeColumn"`
+	Columns    []string `yaml:"columns"`
+}
+
+// rollupWindow time range of raw rows to be aggregated, the buckets
+// containing from and to are included
+type rollupWindow struct {
+	from time.Time
+	to   time.Time
+}
+
+// rollupState rollup loop state, dirty contains the time range of new
+// inserts per raw table not yet aggregated
+type rollupState struct {
+	lock   sync.Mutex
+	config *rollupConfig
+	dirty  map[string]rollupWindow
+	id     common.RegDbID
+	runs   atomic.Uint64
+	failed atomic.Uint64
+}
+
+var rollups *rollupState
+
+// validate check table and column names used in the statements
+func (rc *rollupConfig) validate() error {
+	for _, rt := range rc.Tables {
+		if !identifierRegexp.MatchString(strings.ToLower(rt.Table)) {
+			return fmt.Errorf("invalid rollup table %s", rt.Table)
+		}
+		if !identifierRegexp.MatchString(rt.timeColumn()) {
+			return fmt.Errorf("invalid rollup time column %s", rt.TimeColumn)
+		}
+		if len(rt.Columns) == 0 {
+			return fmt.Errorf("no rollup columns for table %s", rt.Table)
+		}
+		for _, c := range rt.Columns {
+			c = strings.ToLower(c)
+			if !strings.HasPrefix(c, "eco_") || !identifierRegexp.MatchString(c) {
+				return fmt.Errorf("invalid rollup column %s, need eco_ column", c)
+			}
+		}
+	}
+	return nil
+}
+
+// interval time between two rollup runs
+func (rc *rollupConfig) interval() time.Duration {
+	if rc.IntervalSeconds <= 0 {
+		return defaultRollupSeconds * time.Second
+	}
+	return time.Duration(rc.IntervalSeconds) * time.Second
+}
+
+// find rollup configuration of the raw table
+func (rc *rollupConfig) find(tn string) *rollupTable {
+	for _, rt := range rc.Tables {
+		if strings.EqualFold(rt.Table, tn) {
+			return rt
+		}
+	}
+	return nil
+}
+
+// timeColumn time column of raw and rollup table
+func (rt *rollupTable) timeColumn() string {
+	if rt.TimeColumn == "" {
+		return defaultTimescaleColumn
+	}
+	return strings.ToLower(rt.TimeColumn)
+}
+
+// tableName rollup table name of the level
+func (rt *rollupTable) tableName(level rollupLevel) string {
+	return strings.ToLower(rt.Table) + "_" + level.suffix
+}
+
+// createStatement statement creating the rollup table of the level
+func (rt *rollupTable) createStatement(level rollupLevel) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s TIMESTAMPTZ PRIMARY KEY, eco_samples BIGINT",
+		rt.tableName(level), rt.timeColumn()))
+	for _, c := range rt.Columns {
+		for _, a := range rollupAggregates {
+			sb.WriteString(fmt.Sprintf(", %s_%s DOUBLE PRECISION", strings.ToLower(c), a))
+		}
+	}
+	sb.WriteString(")")
+	return sb.String()
+}
+
+// upsertStatement statement recomputing all buckets of the level from the
+// bucket containing from up to the bucket containing to
+func (rt *rollupTable) upsertStatement(level rollupLevel, w rollupWindow) string {
+	tc := rt.timeColumn()
+	names := []string{tc, "eco_samples"}
+	selects := []string{fmt.Sprintf("date_trunc('%s', %s)", level.unit, tc), "count(*)"}
+	for _, c := range rt.Columns {
+		c = strings.ToLower(c)
+		for _, a := range rollupAggregates {
+			names = append(names, c+"_"+a)
+			if a == "last" {
+				selects = append(selects,
+					fmt.Sprintf("(array_agg(%s ORDER BY %s DESC) FILTER (WHERE %s IS NOT NULL))[1]", c, tc, c))
+			} else {
+				selects = append(selects, fmt.Sprintf("%s(%s)", a, c))
+			}
+		}
+	}
+	updates := make([]string, 0, len(names)-1)
+	for _, n := range names[1:] {
+		updates = append(updates, fmt.Sprintf("%s = EXCLUDED.%s", n, n))
+	}
+	return fmt.Sprintf("INSERT INTO %s (%s) SELECT %s FROM %s WHERE %s >= date_trunc('%s', '%s'::timestamptz) "+
+		"AND %s < date_trunc('%s', '%s'::timestamptz) + interval '1 %s' GROUP BY 1 ON CONFLICT (%s) DO UPDATE SET %s",
+		rt.tableName(level), strings.Join(names, ", "), strings.Join(selects, ", "),
+		strings.ToLower(rt.Table), tc, level.unit, w.from.UTC().Format(time.RFC3339Nano),
+		tc, level.unit, w.to.UTC().Format(time.RFC3339Nano), level.unit,
+		tc, strings.Join(updates, ", "))
+}
+
+// split the window into windows of at most rollupWindowSize
+func (w rollupWindow) split() []rollupWindow {
+	windows := make([]rollupWindow, 0, 1)
+	for from := w.from; ; from = from.Add(rollupWindowSize) {
+		to := from.Add(rollupWindowSize)
+		if !to.Before(w.to) {
+			return append(windows, rollupWindow{from, w.to})
+		}
+		windows = append(windows, rollupWindow{from, to})
+	}
+}
+
+// touchRollup mark the time range of inserted entries to be aggregated
+func touchRollup(tn string, entries *common.Entries) {
+	rs := rollups
+	if rs == nil {
+		return
+	}
+	rt := rs.config.find(tn)
+	if rt == nil {
+		return
+	}
+	var earliest, latest time.Time
+	if i := slices.Index(entries.Fields, rt.timeColumn()); i >= 0 {
+		for _, row := range entries.Values {
+			if i >= len(row) {
+				continue
+			}
+			if t, ok := row[i].(time.Time); ok {
+				if earliest.IsZero() || t.Before(earliest) {
+					earliest = t
+				}
+				if t.After(latest) {
+					latest = t
+				}
+			}
+		}
+	}
+	if earliest.IsZero() {
+		earliest = time.Now()
+		latest = earliest
+	}
+	rs.touch(rt.Table, rollupWindow{earliest, latest})
+}
+
+// touch extend the dirty time range of the table
+func (rs *rollupState) touch(tn string, w rollupWindow) {
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+	if d, ok := rs.dirty[tn]; ok {
+		if d.from.Before(w.from) {
+			w.from = d.from
+		}
+		if d.to.After(w.to) {
+			w.to = d.to
+		}
+	}
+	rs.dirty[tn] = w
+}
+
+// StartRollups create rollup tables and start the loop backfilling missing
+// buckets and aggregating new inserts
+func StartRollups() {
+	if adapter.DatabaseConfig == nil || adapter.DatabaseConfig.Rollup == nil ||
+		len(adapter.DatabaseConfig.Rollup.Tables) == 0 {
+		return
+	}
+	if dbRef == nil || dbRef.Driver != common.PostgresType {
+		services.ServerMessage("Rollup tables need a Postgres database, rollups disabled")
+		return
+	}
+	rs := &rollupState{config: adapter.DatabaseConfig.Rollup, dirty: make(map[string]rollupWindow)}
+	rs.id = connnectDatabase()
+	for _, rt := range rs.config.Tables {
+		for _, level := range rollupLevels {
+			err := rs.id.Batch(rt.createStatement(level))
+			if err != nil {
+				services.ServerMessage("Error creating rollup table %s: %v", rt.tableName(level), err)
+				return
+			}
+		}
+	}
+	rollups = rs
+	go rs.loop()
+}
+
+// backfill mark all buckets since the last rollup bucket dirty, all raw rows
+// if the rollup table is empty. The loop aggregates them in bounded windows
+func (rs *rollupState) backfill(rt *rollupTable) {
+	var from time.Time
+	for _, level := range rollupLevels {
+		t, ok := rs.selectTime(fmt.Sprintf("SELECT max(%s) FROM %s", rt.timeColumn(), rt.tableName(level)))
+		if !ok {
+			t, ok = rs.selectTime(fmt.Sprintf("SELECT min(%s) FROM %s", rt.timeColumn(), strings.ToLower(rt.Table)))
+			if !ok {
+				continue
+			}
+			services.ServerMessage("Backfill rollup table %s since %v", rt.tableName(level), t)
+		}
+		if from.IsZero() || t.Before(from) {
+			from = t
+		}
+	}
+	if !from.IsZero() {
+		rs.touch(rt.Table, rollupWindow{from, time.Now()})
+	}
+}
+
+// selectTime query one timestamp, false if no timestamp is available
+func (rs *rollupState) selectTime(query string) (time.Time, bool) {
+	rows, err := rs.id.BatchSelect(query)
+	if err != nil {
+		log.Log.Errorf("Error query %s: %v", query, err)
+		return time.Time{}, false
+	}
+	if len(rows) == 0 || len(rows[0]) == 0 {
+		return time.Time{}, false
+	}
+	t, ok := rows[0][0].(time.Time)
+	return t, ok
+}
+
+// run aggregate one level
+func (rs *rollupState) run(rt *rollupTable, level rollupLevel, w rollupWindow) error {
+	err := rs.id.Batch(rt.upsertStatement(level, w))
+	rs.runs.Add(1)
+	if err != nil {
+		rs.failed.Add(1)
+	}
+	return err
+}
+
+// aggregate all levels of the window
+func (rs *rollupState) aggregate(rt *rollupTable, w rollupWindow) error {
+	for _, level := range rollupLevels {
+		err := rs.run(rt, level, w)
+		if err != nil {
+			log.Log.Errorf("Error aggregating rollup table %s: %v", rt.tableName(level), err)
+			return err
+		}
+	}
+	return nil
+}
+
+// loop backfill the rollup tables and aggregate dirty tables window by
+// window, the remaining time range of failed tables is kept dirty and the
+// connection is reconnected
+func (rs *rollupState) loop() {
+	for _, rt := range rs.config.Tables {
+		rs.backfill(rt)
+	}
+	ticker := time.NewTicker(rs.config.interval())
+	for {
+		select {
+		case <-ticker.C:
+			rs.lock.Lock()
+			dirty := rs.dirty
+			rs.dirty = make(map[string]rollupWindow)
+			rs.lock.Unlock()
+			for tn, dw := range dirty {
+				rt := rs.config.find(tn)
+				for _, w := range dw.split() {
+					if err := rs.aggregate(rt, w); err != nil {
+						rs.touch(tn, rollupWindow{w.from, dw.to})
+						rs.id.Close()
+						rs.id = connnectDatabase()
+						break
+					}
+				}
+			}
+		case <-quit:
+			ticker.Stop()
+			return
+		}
+	}
+}
+
+// String statistic output of the rollups
+func (rs *rollupState) String() string {
+	return fmt.Sprintf("rollup runs %03d failed %03d ", rs.runs.Load(), rs.failed.Load())
+}
@@ -0,0 +1,64 @@
+/*
+* Copyright 2025-2026 Thorsten A. Knieling
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*    http://www.apache.org/licenses/LICENSE-2.0
+*
+ */
+
+package ecoflow2db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tknie/flynn/common"
+)
+
+func TestRollupStatements(t *testing.T) {
+	rt := &rollupTable{Table: "Device_Quota", Columns: []string{"eco_power"}}
+	assert.NoError(t, (&rollupConfig{Tables: []*rollupTable{rt}}).validate())
+	assert.Equal(t, "device_quota_1h", rt.tableName(rollupLevels[1]))
+	assert.Equal(t, "CREATE TABLE IF NOT EXISTS device_quota_1m (eco_timestamp TIMESTAMPTZ PRIMARY KEY, "+
+		"eco_samples BIGINT, eco_power_avg DOUBLE PRECISION, eco_power_min DOUBLE PRECISION, "+
+		"eco_power_max DOUBLE PRECISION, eco_power_last DOUBLE PRECISION)", rt.createStatement(rollupLevels[0]))
+	from := time.Date(2025, 6, 1, 12, 30, 15, 0, time.UTC)
+	assert.Equal(t, "INSERT INTO device_quota_1d (eco_timestamp, eco_samples, eco_power_avg, eco_power_min, "+
+		"eco_power_max, eco_power_last) SELECT date_trunc('day', eco_timestamp), count(*), avg(eco_power), "+
+		"min(eco_power), max(eco_power), (array_agg(eco_power ORDER BY eco_timestamp DESC) "+
+		"FILTER (WHERE eco_power IS NOT NULL))[1] FROM device_quota "+
+		"WHERE eco_timestamp >= date_trunc('day', '2025-06-01T12:30:15Z'::timestamptz) "+
+		"AND eco_timestamp < date_trunc('day', '2025-06-02T08:00:00Z'::timestamptz) + interval '1 day' GROUP BY 1 "+
+		"ON CONFLICT (eco_timestamp) DO UPDATE SET eco_samples = EXCLUDED.eco_samples, "+
+		"eco_power_avg = EXCLUDED.eco_power_avg, eco_power_min = EXCLUDED.eco_power_min, "+
+		"eco_power_max = EXCLUDED.eco_power_max, eco_power_last = EXCLUDED.eco_power_last",
+		rt.upsertStatement(rollupLevels[2], rollupWindow{from, time.Date(2025, 6, 2, 8, 0, 0, 0, time.UTC)}))
+
+	// long ranges are aggregated in windows of one day
+	w := rollupWindow{from, from.Add(50 * time.Hour)}
+	assert.Equal(t, []rollupWindow{{from, from.Add(24 * time.Hour)}, {from.Add(24 * time.Hour), from.Add(48 * time.Hour)},
+		{from.Add(48 * time.Hour), from.Add(50 * time.Hour)}}, w.split())
+	assert.Equal(t, []rollupWindow{{from, from}}, rollupWindow{from, from}.split())
+
+	assert.Error(t, (&rollupConfig{Tables: []*rollupTable{{Table: "x", Columns: []string{"power"}}}}).validate())
+	assert.Error(t, (&rollupConfig{Tables: []*rollupTable{{Table: "x"}}}).validate())
+	assert.Error(t, (&rollupConfig{Tables: []*rollupTable{{Table: "x;", Columns: []string{"eco_a"}}}}).validate())
+}
+
+func TestTouchRollup(t *testing.T) {
+	rs := &rollupState{config: &rollupConfig{Tables: []*rollupTable{{Table: "Rollup_Raw",
+		Columns: []string{"eco_power"}}}}, dirty: make(map[string]rollupWindow)}
+	old := rollups
+	rollups = rs
+	defer func() { rollups = old }()
+	ts := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	fields := []string{"eco_timestamp", "eco_power"}
+	touchRollup("rollup_raw", &common.Entries{Fields: fields, Values: [][]any{{ts.Add(time.Minute), 1}, {ts, 2}}})
+	touchRollup("rollup_raw", &common.Entries{Fields: fields, Values: [][]any{{ts.Add(time.Hour), 1}}})
+	touchRollup("other", &common.Entries{Fields: fields, Values: [][]any{{ts, 1}}})
+	assert.Equal(t, map[string]rollupWindow{"Rollup_Raw": {ts, ts.Add(time.Hour)}}, rs.dirty)
+}
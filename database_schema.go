@@ -0,0 +1,278 @@
+/*
+* Copyright 2025-2026 Thorsten A. Knieling
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*    http://www.apache.org/licenses/LICENSE-2.0
+*
+ */
+
+package ecoflow2db
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/tknie/flynn/common"
+	"github.com/tknie/log"
+	"github.com/tknie/services"
+)
+
+// columnKind value kind of a column, a column can only be widened to a
+// higher kind
+type columnKind int
+
+const (
+	kindOther columnKind = iota
+	kindInteger
+	kindDecimal
+	kindAlpha
+)
+
+func (ck columnKind) String() string {
+	switch ck {
+	case kindInteger:
+		return "BigInteger"
+	case kindDecimal:
+		return "Decimal"
+	case kindAlpha:
+		return "Alpha"
+	}
+	return "Other"
+}
+
+// maxVarcharLength longest VARCHAR a column is widened to, longer values
+// are stored in TEXT columns
+const maxVarcharLength = 8192
+
+// schemaColumn kind and maximum character length of a column, a length of
+// 0 is unbounded
+type schemaColumn struct {
+	kind   columnKind
+	length int
+}
+
+func (sc schemaColumn) String() string {
+	if sc.kind == kindAlpha && sc.length > 0 {
+		return fmt.Sprintf("%s(%d)", sc.kind, sc.length)
+	}
+	return sc.kind.String()
+}
+
+// sqlType SQL type a column is widened to
+func (sc schemaColumn) sqlType() string {
+	switch sc.kind {
+	case kindDecimal:
+		return common.Decimal.SqlType(20, 5)
+	case kindAlpha:
+		if sc.length == 0 {
+			return common.Text.SqlType()
+		}
+		return common.Alpha.SqlType(sc.length)
+	}
+	return ""
+}
+
+// alphaLength column length for values up to the given length, the length
+// is doubled starting with 1024 up to the maximum VARCHAR length
+func alphaLength(n int) int {
+	l := 1024
+	for l < n {
+		l *= 2
+	}
+	if l > maxVarcharLength {
+		return 0
+	}
+	return l
+}
+
+// valueLength character length of the value stored in an alpha column
+func valueLength(v any) int {
+	switch val := v.(type) {
+	case string:
+		return utf8.RuneCountInString(val)
+	case []interface{}, map[string]interface{}:
+		b, err := json.Marshal(val)
+		if err != nil {
+			return 0
+		}
+		return utf8.RuneCount(b)
+	}
+	return len(fmt.Sprint(v))
+}
+
+// widenTo column the value fits into, false if the current column is
+// sufficient. Alpha columns with limited length are lengthened
+func (sc schemaColumn) widenTo(v any) (schemaColumn, bool) {
+	needed := valueKind(v)
+	if sc.kind == kindOther || needed == kindOther || needed < sc.kind {
+		return sc, false
+	}
+	switch {
+	case needed > sc.kind && needed == kindAlpha:
+		return schemaColumn{kind: kindAlpha, length: alphaLength(valueLength(v))}, true
+	case needed > sc.kind:
+		return schemaColumn{kind: needed}, true
+	case needed == kindAlpha && sc.length > 0 && valueLength(v) > sc.length:
+		return schemaColumn{kind: kindAlpha, length: alphaLength(valueLength(v))}, true
+	}
+	return sc, false
+}
+
+// valueKind column kind needed to store the value
+func valueKind(v any) columnKind {
+	switch val := v.(type) {
+	case float64:
+		if val == math.Trunc(val) && val < math.MaxInt64 {
+			return kindInteger
+		}
+		return kindDecimal
+	case int, int32, int64:
+		return kindInteger
+	case float32:
+		return kindDecimal
+	case string, []interface{}, map[string]interface{}:
+		return kindAlpha
+	}
+	return kindOther
+}
+
+// sqlKind column kind of the information schema data type
+func sqlKind(dataType string) columnKind {
+	switch strings.ToLower(dataType) {
+	case "bigint", "integer", "int", "smallint", "tinyint", "mediumint":
+		return kindInteger
+	case "numeric", "decimal", "double precision", "double", "real", "float":
+		return kindDecimal
+	case "character varying", "varchar", "text", "character", "char", "mediumtext", "longtext":
+		return kindAlpha
+	}
+	return kindOther
+}
+
+// widenStatement DDL widening the column to the type
+func widenStatement(driver common.ReferenceType, tn, column string, sc schemaColumn) string {
+	return dialectOf(driver).widenColumn(tn, column, sc.sqlType())
+}
+
+var schemaLock sync.Mutex
+var schemaColumns = make(map[string]map[string]schemaColumn)
+
+// schemaMissing data keys of a table without column after reading the
+// columns, they do not trigger another read
+var schemaMissing = make(map[string]map[string]bool)
+
+// columnsStatement query of the column types of the table in the current
+// schema
+func columnsStatement(driver common.ReferenceType, tn string) string {
+	return fmt.Sprintf("SELECT column_name, data_type, character_maximum_length FROM information_schema.columns"+
+		" WHERE table_schema = %s AND table_name = '%s'", dialectOf(driver).currentSchema(), strings.ToLower(tn))
+}
+
+// readColumns read the column types of the table
+func readColumns(id common.RegDbID, driver common.ReferenceType, tn string) (map[string]schemaColumn, error) {
+	rows, err := id.BatchSelect(columnsStatement(driver, tn))
+	if err != nil {
+		return nil, err
+	}
+	columns := make(map[string]schemaColumn)
+	for _, r := range rows {
+		if len(r) < 3 {
+			continue
+		}
+		columns[strings.ToLower(schemaString(r[0]))] = schemaColumn{kind: sqlKind(schemaString(r[1])),
+			length: int(resultInt64(r[2]))}
+	}
+	return columns, nil
+}
+
+func schemaString(v any) string {
+	if b, ok := v.([]byte); ok {
+		return string(b)
+	}
+	return fmt.Sprint(v)
+}
+
+// forgetColumns columns of the table are changed and need to be read again
+func forgetColumns(tn string) {
+	schemaLock.Lock()
+	defer schemaLock.Unlock()
+	delete(schemaColumns, tn)
+	delete(schemaMissing, tn)
+}
+
+// widenColumns widen all columns the new values do not fit into
+// (BigInteger to Decimal to Alpha, short Alpha to longer Alpha)
+func widenColumns(id *common.RegDbID, tn string, data map[string]interface{}) {
+	schemaLock.Lock()
+	defer schemaLock.Unlock()
+	driver := common.PostgresType
+	if dbRef != nil {
+		driver = dbRef.Driver
+	}
+	columns, ok := schemaColumns[tn]
+	if !ok || missingColumn(columns, schemaMissing[tn], data) {
+		err := schemaCall(id, func(id common.RegDbID) (err error) {
+			columns, err = readColumns(id, driver, tn)
+			return err
+		})
+		if err != nil {
+			log.Log.Errorf("Error reading column types of %s: %v", tn, err)
+			return
+		}
+		schemaColumns[tn] = columns
+		missing := make(map[string]bool)
+		for k := range data {
+			if _, found := columns[columnName(k)]; !found {
+				missing[columnName(k)] = true
+			}
+		}
+		schemaMissing[tn] = missing
+	}
+	for k, v := range data {
+		name := columnName(k)
+		current, found := columns[name]
+		if !found {
+			continue
+		}
+		needed, widen := current.widenTo(v)
+		if !widen {
+			continue
+		}
+		start := time.Now()
+		err := schemaCall(id, func(id common.RegDbID) error {
+			return id.Batch(widenStatement(driver, strings.ToLower(tn), name, needed))
+		})
+		if err != nil {
+			services.ServerMessage("Error widening column %s of %s to %s: %v", name, tn, needed, err)
+			continue
+		}
+		columns[name] = needed
+		services.ServerMessage("Schema change: column %s of %s widened from %s to %s (value %v) in %v",
+			name, tn, current, needed, v, time.Since(start))
+	}
+}
+
+// missingColumn check if a data key has no known column, the columns need
+// to be read again. Keys without column after the last read are ignored
+func missingColumn(columns map[string]schemaColumn, missing map[string]bool, data map[string]interface{}) bool {
+	for k := range data {
+		name := columnName(k)
+		if _, found := columns[name]; !found && !missing[name] {
+			return true
+		}
+	}
+	return false
+}
+
+// columnName database column name of the data key
+func columnName(k string) string {
+	return "eco_" + strings.ReplaceAll(strings.ToLower(k), ".", "_")
+}
@@ -0,0 +1,86 @@
+/*
+* Copyright 2025-2026 Thorsten A. Knieling
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*    http://www.apache.org/licenses/LICENSE-2.0
+*
+ */
+
+package ecoflow2db
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/tknie/flynn/common"
+)
+
+func TestColumnWidening(t *testing.T) {
+	assert.Equal(t, kindInteger, valueKind(12.0))
+	assert.Equal(t, kindDecimal, valueKind(12.5))
+	assert.Equal(t, kindAlpha, valueKind("12"))
+	assert.Equal(t, kindAlpha, valueKind(map[string]interface{}{"a": 1}))
+	assert.Equal(t, kindOther, valueKind(time.Now()))
+
+	assert.Equal(t, kindInteger, sqlKind("bigint"))
+	assert.Equal(t, kindDecimal, sqlKind("numeric"))
+	assert.Equal(t, kindAlpha, sqlKind("character varying"))
+	assert.Equal(t, kindOther, sqlKind("timestamp with time zone"))
+
+	assert.Equal(t, "ALTER TABLE device_quota ALTER COLUMN eco_power TYPE DECIMAL(20,5) USING eco_power::DECIMAL(20,5)",
+		widenStatement(common.PostgresType, "device_quota", "eco_power", schemaColumn{kind: kindDecimal}))
+	assert.Equal(t, "ALTER TABLE device_quota MODIFY COLUMN eco_mode VARCHAR(1024)",
+		widenStatement(common.MysqlType, "device_quota", "eco_mode", schemaColumn{kind: kindAlpha, length: 1024}))
+	assert.Equal(t, "ALTER TABLE device_quota MODIFY COLUMN eco_mode TEXT",
+		widenStatement(common.MysqlType, "device_quota", "eco_mode", schemaColumn{kind: kindAlpha}))
+
+	assert.Equal(t, "SELECT column_name, data_type, character_maximum_length FROM information_schema.columns"+
+		" WHERE table_schema = current_schema() AND table_name = 'device_quota'",
+		columnsStatement(common.PostgresType, "Device_Quota"))
+	assert.Contains(t, columnsStatement(common.MysqlType, "device_quota"), "table_schema = DATABASE()")
+
+	// integer to decimal, short alpha to longer alpha
+	sc, widen := schemaColumn{kind: kindInteger}.widenTo(1.5)
+	assert.True(t, widen)
+	assert.Equal(t, schemaColumn{kind: kindDecimal}, sc)
+	_, widen = schemaColumn{kind: kindDecimal}.widenTo(2.0)
+	assert.False(t, widen)
+	_, widen = schemaColumn{kind: kindAlpha, length: 255}.widenTo("short")
+	assert.False(t, widen)
+	sc, widen = schemaColumn{kind: kindAlpha, length: 255}.widenTo(strings.Repeat("x", 300))
+	assert.True(t, widen)
+	assert.Equal(t, schemaColumn{kind: kindAlpha, length: 1024}, sc)
+	sc, widen = schemaColumn{kind: kindAlpha, length: 1024}.widenTo(strings.Repeat("x", 3000))
+	assert.True(t, widen)
+	assert.Equal(t, schemaColumn{kind: kindAlpha, length: 4096}, sc)
+	sc, widen = schemaColumn{kind: kindAlpha, length: 8192}.widenTo(strings.Repeat("x", 9000))
+	assert.True(t, widen)
+	assert.Equal(t, "TEXT", sc.sqlType())
+	_, widen = schemaColumn{kind: kindAlpha}.widenTo(strings.Repeat("x", 90000))
+	assert.False(t, widen)
+
+	columns := map[string]schemaColumn{"eco_pd_watts": {kind: kindInteger}}
+	assert.False(t, missingColumn(columns, nil, map[string]interface{}{"pd.watts": 1.0}))
+	assert.True(t, missingColumn(columns, nil, map[string]interface{}{"pd.volt": 1.0}))
+	// keys without column after the last read do not read again
+	assert.False(t, missingColumn(columns, map[string]bool{"eco_pd_volt": true}, map[string]interface{}{"pd.volt": 1.0}))
+}
+
+func TestSchemaCall(t *testing.T) {
+	id := common.RegDbID(7)
+	calls := 0
+	err := schemaCall(&id, func(id common.RegDbID) error {
+		calls++
+		return &pgconn.PgError{Code: "42701", Message: "column already exists"}
+	})
+	// errors of the statement do not reconnect the handle
+	assert.Error(t, err)
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, common.RegDbID(7), id)
+}
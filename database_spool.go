@@ -0,0 +1,450 @@
+/*
+* Copyright 2025-2026 Thorsten A. Knieling
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*    http://www.apache.org/licenses/LICENSE-2.0
+*
+ */
+
+package ecoflow2db
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/tknie/ecoflow"
+	"github.com/tknie/flynn/common"
+	"github.com/tknie/log"
+	"github.com/tknie/services"
+)
+
+const defaultSpoolSegmentKB = 1024
+const defaultSpoolMaxSizeMB = 100
+const defaultQuarantineFiles = 10
+
+// spoolConfig spool of failed inserts. The quarantine keeps at most
+// QuarantineFiles rotated segments besides the current one
+type spoolConfig struct {
+	File            string `yaml:"file"`
+	Quarantine      string `yaml:"quarantine"`
+	QuarantineFiles int    `yaml:"quarantineFiles"`
+	SegmentKB       int64  `yaml:"segmentKB"`
+	MaxSizeMB       int64  `yaml:"maxSizeMB"`
+}
+
+// spoolValue typed value of a spooled row, the kind is needed to restore
+// the original Go type
+type spoolValue struct {
+	Kind  string          `json:"k"`
+	Value json.RawMessage `json:"v,omitempty"`
+}
+
+// spoolRecord one failed insert of a table. Struct inserts are stored as
+// JSON of the struct with its type name, the error is set in the quarantine
+type spoolRecord struct {
+	Table  string          `json:"table"`
+	Fields []string        `json:"fields"`
+	Rows   [][]spoolValue  `json:"rows,omitempty"`
+	Type   string          `json:"type,omitempty"`
+	Struct json.RawMessage `json:"struct,omitempty"`
+	Error  string          `json:"error,omitempty"`
+	Seq    uint64          `json:"seq,omitempty"`
+}
+
+// spoolTypes struct types of spooled struct inserts
+var spoolTypes sync.Map
+
+var errSpoolTypeUnknown = fmt.Errorf("struct type of spool record not known yet")
+
+// spool durable append-only segments of failed inserts. Segments are
+// replayed in order, the oldest segments are dropped if the maximum size
+// is exceeded. Records the database rejects are moved into the quarantine.
+// The committed functions of spooled records are called after the replay
+type spool struct {
+	lock       sync.Mutex
+	seq        atomic.Uint64
+	committed  map[uint64][]func()
+	file       *rotatingFile
+	quarantine *rotatingFile
+	maxSize    int64
+	size       atomic.Int64
+	spooled    atomic.Uint64
+	replayed   atomic.Uint64
+	dropped    atomic.Uint64
+	rejected   atomic.Uint64
+}
+
+// newSpool create spool of the configuration, nil if not configured
+func (sc *spoolConfig) newSpool() *spool {
+	if sc == nil || sc.File == "" {
+		return nil
+	}
+	segmentKB := sc.SegmentKB
+	if segmentKB <= 0 {
+		segmentKB = defaultSpoolSegmentKB
+	}
+	maxSizeMB := sc.MaxSizeMB
+	if maxSizeMB <= 0 {
+		maxSizeMB = defaultSpoolMaxSizeMB
+	}
+	quarantine := sc.Quarantine
+	if quarantine == "" {
+		quarantine = sc.File + "-rejected"
+	}
+	quarantineFiles := sc.QuarantineFiles
+	if quarantineFiles <= 0 {
+		quarantineFiles = defaultQuarantineFiles
+	}
+	s := &spool{file: newRotatingFile(sc.File, segmentKB*1024, 0, 0),
+		quarantine: newRotatingFile(quarantine, segmentKB*1024, 0, quarantineFiles), maxSize: maxSizeMB * 1024 * 1024,
+		committed: make(map[uint64][]func())}
+	// sequence numbers of records of earlier runs are never reused
+	s.seq.Store(uint64(time.Now().UnixNano()))
+	for _, f := range allFiles(s.file.name) {
+		if fi, err := os.Stat(f); err == nil {
+			s.size.Add(fi.Size())
+		}
+	}
+	if s.pending() > 0 {
+		services.ServerMessage("Database spool %s contains %d bytes to be replayed", s.file.name, s.pending())
+	}
+	return s
+}
+
+// encodeSpoolValue convert value into typed spool value
+func encodeSpoolValue(v any) (spoolValue, error) {
+	var kind string
+	switch v.(type) {
+	case nil:
+		return spoolValue{Kind: "nil"}, nil
+	case int64:
+		kind = "int64"
+	case int32:
+		kind = "int32"
+	case int:
+		kind = "int"
+	case float64:
+		kind = "float64"
+	case float32:
+		kind = "float32"
+	case bool:
+		kind = "bool"
+	case string:
+		kind = "string"
+	case time.Time:
+		kind = "time"
+	case []byte:
+		kind = "bytes"
+	default:
+		return spoolValue{}, fmt.Errorf("type %T cannot be spooled", v)
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return spoolValue{}, err
+	}
+	return spoolValue{Kind: kind, Value: b}, nil
+}
+
+// decode restore the original value
+func (sv *spoolValue) decode() (any, error) {
+	var err error
+	switch sv.Kind {
+	case "nil":
+		return nil, nil
+	case "int64":
+		var v int64
+		err = json.Unmarshal(sv.Value, &v)
+		return v, err
+	case "int32":
+		var v int32
+		err = json.Unmarshal(sv.Value, &v)
+		return v, err
+	case "int":
+		var v int
+		err = json.Unmarshal(sv.Value, &v)
+		return v, err
+	case "float64":
+		var v float64
+		err = json.Unmarshal(sv.Value, &v)
+		return v, err
+	case "float32":
+		var v float32
+		err = json.Unmarshal(sv.Value, &v)
+		return v, err
+	case "bool":
+		var v bool
+		err = json.Unmarshal(sv.Value, &v)
+		return v, err
+	case "string":
+		var v string
+		err = json.Unmarshal(sv.Value, &v)
+		return v, err
+	case "time":
+		var v time.Time
+		err = json.Unmarshal(sv.Value, &v)
+		return v, err
+	case "bytes":
+		var v []byte
+		err = json.Unmarshal(sv.Value, &v)
+		return v, err
+	}
+	return nil, fmt.Errorf("unknown spool value kind %s", sv.Kind)
+}
+
+// entries database entries of the spool record
+func (sr *spoolRecord) entries() (*common.Entries, error) {
+	if sr.Type != "" {
+		t, ok := spoolTypes.Load(sr.Type)
+		if !ok {
+			return nil, errSpoolTypeUnknown
+		}
+		st := t.(reflect.Type)
+		var object any
+		if st.Kind() == reflect.Ptr {
+			v := reflect.New(st.Elem())
+			if err := json.Unmarshal(sr.Struct, v.Interface()); err != nil {
+				return nil, err
+			}
+			object = v.Interface()
+		} else {
+			v := reflect.New(st)
+			if err := json.Unmarshal(sr.Struct, v.Interface()); err != nil {
+				return nil, err
+			}
+			object = v.Elem().Interface()
+		}
+		return &common.Entries{DataStruct: object, Fields: sr.Fields, Values: [][]any{{object}}}, nil
+	}
+	values := make([][]any, 0, len(sr.Rows))
+	for _, r := range sr.Rows {
+		row := make([]any, 0, len(r))
+		for _, sv := range r {
+			v, err := sv.decode()
+			if err != nil {
+				return nil, err
+			}
+			row = append(row, v)
+		}
+		values = append(values, row)
+	}
+	return &common.Entries{Fields: sr.Fields, Values: values}, nil
+}
+
+// newSpoolRecord spool record of the entries
+func newSpoolRecord(tn string, entries *common.Entries) (*spoolRecord, error) {
+	sr := &spoolRecord{Table: tn, Fields: entries.Fields}
+	if entries.DataStruct != nil {
+		b, err := json.Marshal(entries.DataStruct)
+		if err != nil {
+			return nil, err
+		}
+		sr.Type = ecoflow.GetTypeName(entries.DataStruct)
+		sr.Struct = b
+		spoolTypes.Store(sr.Type, reflect.TypeOf(entries.DataStruct))
+		return sr, nil
+	}
+	for _, r := range entries.Values {
+		row := make([]spoolValue, 0, len(r))
+		for _, v := range r {
+			sv, err := encodeSpoolValue(v)
+			if err != nil {
+				return nil, err
+			}
+			row = append(row, sv)
+		}
+		sr.Rows = append(sr.Rows, row)
+	}
+	return sr, nil
+}
+
+// rows number of rows of the record
+func (sr *spoolRecord) rows() int {
+	if sr.Type != "" {
+		return 1
+	}
+	return len(sr.Rows)
+}
+
+// append store the failed insert in the spool, the committed functions are
+// called if the record is replayed
+func (s *spool) append(tn string, entries *common.Entries, committed ...func()) error {
+	sr, err := newSpoolRecord(tn, entries)
+	if err != nil {
+		return err
+	}
+	if len(committed) > 0 {
+		sr.Seq = s.seq.Add(1)
+	}
+	b, err := json.Marshal(sr)
+	if err != nil {
+		return err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	err = s.writeLine(b)
+	if err != nil {
+		return err
+	}
+	if sr.Seq != 0 {
+		s.committed[sr.Seq] = committed
+	}
+	s.spooled.Add(uint64(sr.rows()))
+	s.truncate()
+	return nil
+}
+
+// reject store the insert the database rejected into the quarantine
+func (s *spool) reject(tn string, entries *common.Entries, cause error) error {
+	sr, err := newSpoolRecord(tn, entries)
+	if err != nil {
+		return err
+	}
+	return s.rejectRecord(sr, cause)
+}
+
+// rejectRecord store the record with the error into the quarantine
+func (s *spool) rejectRecord(sr *spoolRecord, cause error) error {
+	delete(s.committed, sr.Seq)
+	sr.Seq = 0
+	sr.Error = cause.Error()
+	b, err := json.Marshal(sr)
+	if err != nil {
+		return err
+	}
+	err = s.quarantine.writeLine(b)
+	if err != nil {
+		return err
+	}
+	s.rejected.Add(uint64(sr.rows()))
+	services.ServerMessage("Database rejected %d records of %s, moved into quarantine %s: %v",
+		sr.rows(), sr.Table, s.quarantine.name, cause)
+	return nil
+}
+
+// truncate remove oldest segments if the maximum size is exceeded
+func (s *spool) truncate() {
+	segments := rotatedFiles(s.file.name)
+	for len(segments) > 0 && s.pending() > s.maxSize {
+		if fi, err := os.Stat(segments[0]); err == nil {
+			s.dropped.Add(uint64(fi.Size()))
+			s.size.Add(-fi.Size())
+		}
+		services.ServerMessage("Database spool exceeds %d bytes, drop segment %s", s.maxSize, segments[0])
+		os.Remove(segments[0])
+		segments = segments[1:]
+	}
+}
+
+// writeLine append the line to the spool and count the bytes
+func (s *spool) writeLine(b []byte) error {
+	err := s.file.writeLine(b)
+	if err != nil {
+		return err
+	}
+	s.size.Add(int64(len(b)) + 1)
+	return nil
+}
+
+// pending bytes in the spool waiting to be replayed
+func (s *spool) pending() int64 {
+	return s.size.Load()
+}
+
+// replay insert all spooled records in order. Replayed segments are
+// removed, on transient insert error the remaining records are kept.
+// Records the database rejects are moved into the quarantine, records of
+// struct types not known yet are spooled again
+func (s *spool) replay(insert func(tn string, entries *common.Entries) error) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.pending() == 0 {
+		return nil
+	}
+	s.file.mu.Lock()
+	if s.file.file != nil {
+		s.file.rotate()
+	}
+	s.file.mu.Unlock()
+	deferred := make([][]byte, 0)
+	defer func() {
+		for _, line := range deferred {
+			if err := s.writeLine(line); err != nil {
+				log.Log.Errorf("Error spooling deferred record: %v", err)
+			}
+		}
+	}()
+	for _, segment := range rotatedFiles(s.file.name) {
+		data, err := os.ReadFile(segment)
+		if err != nil {
+			return err
+		}
+		lines := bytes.Split(bytes.TrimSpace(data), []byte("\n"))
+		for i, line := range lines {
+			if len(line) == 0 {
+				continue
+			}
+			sr := &spoolRecord{}
+			err = json.Unmarshal(line, sr)
+			if err != nil {
+				log.Log.Errorf("Skip invalid spool record in %s: %v", segment, err)
+				continue
+			}
+			entries, err := sr.entries()
+			if err == errSpoolTypeUnknown {
+				deferred = append(deferred, line)
+				continue
+			}
+			if err != nil {
+				if qerr := s.rejectRecord(sr, err); qerr != nil {
+					log.Log.Errorf("Error writing quarantine of %s: %v", sr.Table, qerr)
+				}
+				continue
+			}
+			err = insert(sr.Table, entries)
+			switch {
+			case err == nil:
+				s.replayed.Add(uint64(sr.rows()))
+				for _, c := range s.committed[sr.Seq] {
+					c()
+				}
+				delete(s.committed, sr.Seq)
+			case isTransientError(err):
+				rest := append(bytes.Join(lines[i:], []byte("\n")), '\n')
+				if werr := os.WriteFile(segment, rest, 0644); werr != nil {
+					log.Log.Errorf("Error rewriting spool segment %s: %v", segment, werr)
+				} else {
+					s.size.Add(int64(len(rest) - len(data)))
+				}
+				return err
+			default:
+				if qerr := s.rejectRecord(sr, err); qerr != nil {
+					log.Log.Errorf("Error writing quarantine of %s: %v", sr.Table, qerr)
+				}
+			}
+		}
+		if os.Remove(segment) == nil {
+			s.size.Add(-int64(len(data)))
+		}
+	}
+	if len(deferred) == 0 {
+		// functions of records dropped by the maximum size are released
+		clear(s.committed)
+	}
+	services.ServerMessage("Database spool replayed")
+	return nil
+}
+
+// String statistic output of the spool
+func (s *spool) String() string {
+	return fmt.Sprintf("spool pending %d bytes spooled %03d replayed %03d rejected %03d dropped %d bytes ",
+		s.pending(), s.spooled.Load(), s.replayed.Load(), s.rejected.Load(), s.dropped.Load())
+}
@@ -0,0 +1,154 @@
+/*
+* Copyright 2025-2026 Thorsten A. Knieling
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*    http://www.apache.org/licenses/LICENSE-2.0
+*
+ */
+
+package ecoflow2db
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/tknie/flynn/common"
+)
+
+func TestDatabaseSpool(t *testing.T) {
+	ts := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	inserts := make([]*common.Entries, 0)
+	tables := make([]string, 0)
+	fail := true
+	w := newDbWriter(1, time.Hour, func(tn string, entries *common.Entries) error {
+		if fail {
+			return fmt.Errorf("connection refused")
+		}
+		tables = append(tables, tn)
+		inserts = append(inserts, entries)
+		return nil
+	})
+	w.spool = (&spoolConfig{File: filepath.Join(t.TempDir(), "spool")}).newSpool()
+
+	committed := 0
+	w.add("spool_a", []string{"eco_timestamp", "eco_value"}, [][]any{{ts, int64(1)}}, func() { committed++ })
+	w.add("spool_b", []string{"eco_timestamp", "eco_name"}, [][]any{{ts, "x"}})
+	assert.Equal(t, uint64(2), w.spool.spooled.Load())
+	assert.Equal(t, 0, committed)
+	assert.True(t, w.spool.pending() > 0)
+
+	// database is reachable again, spooled records are replayed first
+	fail = false
+	w.add("spool_a", []string{"eco_timestamp", "eco_value"}, [][]any{{ts.Add(time.Minute), 2.5}})
+	assert.Equal(t, []string{"spool_a", "spool_b", "spool_a"}, tables)
+	if assert.Len(t, inserts, 3) {
+		assert.Equal(t, [][]any{{ts, int64(1)}}, inserts[0].Values)
+		assert.Equal(t, [][]any{{ts, "x"}}, inserts[1].Values)
+		assert.Equal(t, [][]any{{ts.Add(time.Minute), 2.5}}, inserts[2].Values)
+	}
+	assert.Equal(t, uint64(2), w.spool.replayed.Load())
+	assert.Equal(t, int64(0), w.spool.pending())
+	// the committed function of the spooled record is called by the replay
+	assert.Equal(t, 1, committed)
+	assert.Empty(t, w.spool.committed)
+
+	// failing replay keeps the remaining records
+	fail = true
+	w.add("spool_a", []string{"eco_value"}, [][]any{{int64(3)}})
+	w.add("spool_a", []string{"eco_value"}, [][]any{{int64(4)}})
+	calls := 0
+	err := w.spool.replay(func(tn string, entries *common.Entries) error {
+		calls++
+		if calls > 1 {
+			return fmt.Errorf("connection refused")
+		}
+		return nil
+	})
+	assert.Error(t, err)
+	fail = false
+	w.flushAll()
+	if assert.Len(t, inserts, 4) {
+		assert.Equal(t, [][]any{{int64(4)}}, inserts[3].Values)
+	}
+}
+
+func TestDatabaseSpoolMaxSize(t *testing.T) {
+	s := (&spoolConfig{File: filepath.Join(t.TempDir(), "spool"), SegmentKB: 1}).newSpool()
+	s.maxSize = 3000
+	row := [][]any{{"0123456789012345678901234567890123456789012345678901234567890123456789"}}
+	for i := 0; i < 100; i++ {
+		assert.NoError(t, s.append("spool_c", &common.Entries{Fields: []string{"eco_text"}, Values: row}))
+	}
+	assert.True(t, s.pending() <= s.maxSize)
+	assert.True(t, s.dropped.Load() > 0)
+	// the running counter matches the spool files
+	size := int64(0)
+	for _, f := range allFiles(s.file.name) {
+		if fi, err := os.Stat(f); err == nil {
+			size += fi.Size()
+		}
+	}
+	assert.Equal(t, size, s.pending())
+	assert.Equal(t, size, (&spoolConfig{File: s.file.name}).newSpool().pending())
+	assert.Error(t, s.append("spool_c", &common.Entries{Fields: []string{"eco_x"}, Values: [][]any{{struct{}{}}}}))
+}
+
+type spoolStruct struct {
+	Name  string
+	Value int64
+}
+
+func TestDatabaseSpoolQuarantine(t *testing.T) {
+	dir := t.TempDir()
+	inserts := make([]string, 0)
+	down := true
+	w := newDbWriter(1, time.Hour, func(tn string, entries *common.Entries) error {
+		if down {
+			return fmt.Errorf("dial tcp: connection refused")
+		}
+		if tn == "spool_bad" {
+			return &pgconn.PgError{Code: "22001", Message: "value too long for type character varying(255)"}
+		}
+		inserts = append(inserts, tn)
+		return nil
+	})
+	w.spool = (&spoolConfig{File: filepath.Join(dir, "spool")}).newSpool()
+
+	w.add("spool_bad", []string{"eco_text"}, [][]any{{"too long"}})
+	w.writeEntries("spool_struct", &common.Entries{DataStruct: &spoolStruct{Name: "x", Value: 3},
+		Fields: []string{"*"}, Values: [][]any{{&spoolStruct{Name: "x", Value: 3}}}})
+	assert.Equal(t, uint64(2), w.spool.spooled.Load())
+
+	// the rejected record does not block the following records
+	down = false
+	w.add("spool_good", []string{"eco_value"}, [][]any{{int64(1)}})
+	assert.Equal(t, []string{"spool_struct", "spool_good"}, inserts)
+	assert.Equal(t, uint64(1), w.spool.rejected.Load())
+	assert.Equal(t, int64(0), w.spool.pending())
+	w.add("spool_bad", []string{"eco_text"}, [][]any{{"too long"}})
+	w.add("spool_good", []string{"eco_value"}, [][]any{{int64(2)}})
+	assert.Equal(t, uint64(2), w.spool.rejected.Load())
+	assert.Equal(t, int64(0), w.spool.pending())
+	assert.Len(t, allFiles(filepath.Join(dir, "spool-rejected")), 1)
+	assert.Equal(t, defaultQuarantineFiles, w.spool.quarantine.maxFiles)
+
+	// records of unknown struct types are kept
+	sr := &spoolRecord{Table: "spool_struct", Type: "unknownStruct", Struct: []byte("{}")}
+	_, err := sr.entries()
+	assert.Equal(t, errSpoolTypeUnknown, err)
+
+	assert.True(t, isTransientError(fmt.Errorf("conn closed")))
+	assert.True(t, isTransientError(&pgconn.PgError{Code: "08006"}))
+	assert.False(t, isTransientError(&pgconn.PgError{Code: "23505"}))
+	assert.False(t, isTransientError(&mysql.MySQLError{Number: 1406}))
+	assert.True(t, isTransientError(&mysql.MySQLError{Number: 1040}))
+}
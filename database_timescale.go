@@ -0,0 +1,161 @@
+/*
+* Copyright 2025-2026 Thorsten A. Knieling
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*    http://www.apache.org/licenses/LICENSE-2.0
+*
+ */
+
+package ecoflow2db
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/tknie/flynn/common"
+	"github.com/tknie/log"
+	"github.com/tknie/services"
+)
+
+const defaultTimescaleColumn = "eco_timestamp"
+
+var intervalRegexp = regexp.MustCompile(`^\d+ (second|minute|hour|day|week|month)s?$`)
+var identifierRegexp = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+
+// timescaleConfig hypertable configuration used if the target database
+// contains the TimescaleDB extension
+type timescaleConfig struct {
+	Enabled           bool     `yaml:"enabled"`
+	TimeColumn        string   `yaml:"timeColumn"`
+	ChunkInterval     string   `yaml:"chunkInterval"`
+	CompressAfterDays int      `yaml:"compressAfterDays"`
+	CompressSegmentBy []string `yaml:"compressSegmentBy"`
+	RetentionDays     int      `yaml:"retentionDays"`
+}
+
+var timescaleOnce sync.Once
+var timescaleAvailable bool
+
+// timeColumn time column the hypertable is partitioned by
+func (tc *timescaleConfig) timeColumn() string {
+	if tc.TimeColumn == "" {
+		return defaultTimescaleColumn
+	}
+	return strings.ToLower(tc.TimeColumn)
+}
+
+// validate check configuration values used in the statements
+func (tc *timescaleConfig) validate() error {
+	if !identifierRegexp.MatchString(tc.timeColumn()) {
+		return fmt.Errorf("invalid time column %s", tc.TimeColumn)
+	}
+	if tc.ChunkInterval != "" && !intervalRegexp.MatchString(strings.ToLower(tc.ChunkInterval)) {
+		return fmt.Errorf("invalid chunk interval %s, use e.g. '1 day'", tc.ChunkInterval)
+	}
+	if tc.CompressAfterDays < 0 || tc.RetentionDays < 0 {
+		return fmt.Errorf("compression and retention days must not be negative")
+	}
+	for _, s := range tc.CompressSegmentBy {
+		if !identifierRegexp.MatchString(strings.ToLower(s)) {
+			return fmt.Errorf("invalid compress segment column %s", s)
+		}
+	}
+	return nil
+}
+
+// hypertableStatements statements to convert the table into a hypertable
+// and to add the compression and retention policies
+func (tc *timescaleConfig) hypertableStatements(tn string) ([]string, error) {
+	err := tc.validate()
+	if err != nil {
+		return nil, err
+	}
+	tn = strings.ToLower(tn)
+	if !identifierRegexp.MatchString(tn) {
+		return nil, fmt.Errorf("invalid table name %s", tn)
+	}
+	create := fmt.Sprintf("SELECT create_hypertable('%s', '%s'", tn, tc.timeColumn())
+	if tc.ChunkInterval != "" {
+		create += fmt.Sprintf(", chunk_time_interval => INTERVAL '%s'", strings.ToLower(tc.ChunkInterval))
+	}
+	create += ", if_not_exists => TRUE, migrate_data => TRUE)"
+	statements := []string{create}
+	if tc.CompressAfterDays > 0 {
+		compress := fmt.Sprintf("ALTER TABLE %s SET (timescaledb.compress", tn)
+		if len(tc.CompressSegmentBy) > 0 {
+			compress += fmt.Sprintf(", timescaledb.compress_segmentby = '%s'",
+				strings.ToLower(strings.Join(tc.CompressSegmentBy, ", ")))
+		}
+		compress += ")"
+		statements = append(statements, compress,
+			fmt.Sprintf("SELECT add_compression_policy('%s', INTERVAL '%d days', if_not_exists => TRUE)",
+				tn, tc.CompressAfterDays))
+	}
+	if tc.RetentionDays > 0 {
+		statements = append(statements,
+			fmt.Sprintf("SELECT add_retention_policy('%s', INTERVAL '%d days', if_not_exists => TRUE)",
+				tn, tc.RetentionDays))
+	}
+	return statements, nil
+}
+
+// checkTimescale check once if the TimescaleDB extension is installed
+func checkTimescale(id common.RegDbID) bool {
+	timescaleOnce.Do(func() {
+		if dbRef == nil || dbRef.Driver != common.PostgresType {
+			services.ServerMessage("Hypertables need TimescaleDB on Postgres, use plain tables")
+			return
+		}
+		rows, err := id.BatchSelect("SELECT extversion FROM pg_extension WHERE extname = 'timescaledb'")
+		if err != nil || len(rows) == 0 {
+			services.ServerMessage("TimescaleDB extension not available, use plain tables")
+			log.Log.Debugf("TimescaleDB check: %v", err)
+			return
+		}
+		services.ServerMessage("TimescaleDB extension %v available", rows[0])
+		timescaleAvailable = true
+	})
+	return timescaleAvailable
+}
+
+// createHypertable convert the new created table into a hypertable if
+// TimescaleDB is configured and available. On error the table is kept as
+// plain table
+func createHypertable(id common.RegDbID, tn string) {
+	if adapter.DatabaseConfig == nil {
+		return
+	}
+	tc := adapter.DatabaseConfig.Timescale
+	if tc == nil || !tc.Enabled || !checkTimescale(id) {
+		return
+	}
+	columns, err := id.GetTableColumn(strings.ToLower(tn))
+	if err != nil {
+		log.Log.Errorf("Error reading columns of %s: %v", tn, err)
+		return
+	}
+	if !slices.Contains(columns, tc.timeColumn()) {
+		log.Log.Infof("Table %s has no time column %s, no hypertable", tn, tc.timeColumn())
+		return
+	}
+	statements, err := tc.hypertableStatements(tn)
+	if err != nil {
+		services.ServerMessage("Hypertable configuration error: %v", err)
+		return
+	}
+	for _, s := range statements {
+		log.Log.Debugf("Hypertable statement: %s", s)
+		err = id.Batch(s)
+		if err != nil {
+			services.ServerMessage("Error creating hypertable %s, keep plain table: %v", tn, err)
+			return
+		}
+	}
+	services.ServerMessage("Table %s created as hypertable", tn)
+}
@@ -0,0 +1,44 @@
+/*
+* Copyright 2025-2026 Thorsten A. Knieling
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*    http://www.apache.org/licenses/LICENSE-2.0
+*
+ */
+
+package ecoflow2db
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHypertableStatements(t *testing.T) {
+	tc := &timescaleConfig{Enabled: true, ChunkInterval: "1 day"}
+	s, err := tc.hypertableStatements("Mqtt_Meter")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"SELECT create_hypertable('mqtt_meter', 'eco_timestamp', " +
+		"chunk_time_interval => INTERVAL '1 day', if_not_exists => TRUE, migrate_data => TRUE)"}, s)
+
+	tc = &timescaleConfig{Enabled: true, TimeColumn: "eco_time", CompressAfterDays: 7,
+		CompressSegmentBy: []string{"eco_sn"}, RetentionDays: 365}
+	s, err = tc.hypertableStatements("meter")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"SELECT create_hypertable('meter', 'eco_time', if_not_exists => TRUE, migrate_data => TRUE)",
+		"ALTER TABLE meter SET (timescaledb.compress, timescaledb.compress_segmentby = 'eco_sn')",
+		"SELECT add_compression_policy('meter', INTERVAL '7 days', if_not_exists => TRUE)",
+		"SELECT add_retention_policy('meter', INTERVAL '365 days', if_not_exists => TRUE)",
+	}, s)
+
+	_, err = (&timescaleConfig{ChunkInterval: "1 day'; drop table x"}).hypertableStatements("meter")
+	assert.Error(t, err)
+	_, err = (&timescaleConfig{RetentionDays: -1}).hypertableStatements("meter")
+	assert.Error(t, err)
+	_, err = (&timescaleConfig{}).hypertableStatements("meter; drop")
+	assert.Error(t, err)
+}
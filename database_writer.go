@@ -0,0 +1,280 @@
+/*
+* Copyright 2025-2026 Thorsten A. Knieling
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*    http://www.apache.org/licenses/LICENSE-2.0
+*
+ */
+
+package ecoflow2db
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tknie/flynn/common"
+	"github.com/tknie/log"
+	"github.com/tknie/services"
+)
+
+const defaultBatchSize = 50
+const defaultFlushMs = 5000
+
+// tableBuffer rows waiting to be inserted into one table. All rows of a
+// buffer have the same fields
+type tableBuffer struct {
+	tn        string
+	fields    []string
+	values    [][]any
+	committed []func()
+}
+
+// dbWriter write buffer for all tables. The rows are inserted by multi-row
+// inserts if the batch size is reached or the flush interval elapsed
+type dbWriter struct {
+	lock      sync.Mutex
+	dbLock    sync.Mutex
+	buffers   map[string]*tableBuffer
+	batchSize int
+	interval  time.Duration
+	insert    func(tn string, entries *common.Entries) error
+	id        common.RegDbID
+	spool     *spool
+	stop      chan struct{}
+	stopped   sync.WaitGroup
+}
+
+var writer *dbWriter
+var writerOnce sync.Once
+
+// newDbWriter create write buffer, insert is used to write the rows
+func newDbWriter(batchSize int, interval time.Duration,
+	insert func(tn string, entries *common.Entries) error) *dbWriter {
+	if batchSize <= 0 {
+		batchSize = defaultBatchSize
+	}
+	if interval <= 0 {
+		interval = defaultFlushMs * time.Millisecond
+	}
+	return &dbWriter{buffers: make(map[string]*tableBuffer), batchSize: batchSize,
+		interval: interval, insert: insert, stop: make(chan struct{})}
+}
+
+// getWriter get the database write buffer, the flush loop is started with
+// the first usage
+func getWriter() *dbWriter {
+	writerOnce.Do(func() {
+		batchSize := 0
+		flushMs := 0
+		var sc *spoolConfig
+		if adapter.DatabaseConfig != nil {
+			batchSize = adapter.DatabaseConfig.BatchSize
+			flushMs = adapter.DatabaseConfig.FlushIntervalMs
+			sc = adapter.DatabaseConfig.Spool
+		}
+		writer = newDbWriter(batchSize, time.Duration(flushMs)*time.Millisecond, nil)
+		writer.insert = writer.insertDatabase
+		writer.spool = sc.newSpool()
+		writer.start()
+	})
+	return writer
+}
+
+// insertDatabase insert entries using the writer database connection,
+// the connection is reconnected on errors
+func (w *dbWriter) insertDatabase(tn string, entries *common.Entries) error {
+	if w.id == 0 {
+		w.id = connnectDatabase()
+	}
+	_, err := w.id.Insert(tn, entries)
+	if err != nil {
+		w.id.Close()
+		w.id = 0
+	}
+	return err
+}
+
+// start flush loop
+func (w *dbWriter) start() {
+	w.stopped.Add(1)
+	go func() {
+		defer w.stopped.Done()
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				w.flushAll()
+			case <-w.stop:
+				return
+			}
+		}
+	}()
+}
+
+// bufferKey key of the buffer of the table and fields, rows with different
+// fields are buffered separately
+func bufferKey(tn string, fields []string) string {
+	return tn + "\x00" + strings.Join(fields, "\x00")
+}
+
+// add buffer one row of the table. Rows are buffered per table and field
+// list, so tables with alternating fields are still written in batches.
+// The committed functions are called after the rows are inserted
+func (w *dbWriter) add(tn string, fields []string, values [][]any, committed ...func()) {
+	key := bufferKey(tn, fields)
+	w.lock.Lock()
+	b, ok := w.buffers[key]
+	if !ok {
+		b = &tableBuffer{tn: tn, fields: fields}
+		w.buffers[key] = b
+	}
+	b.values = append(b.values, values...)
+	for _, c := range committed {
+		if c != nil {
+			b.committed = append(b.committed, c)
+		}
+	}
+	full := len(b.values) >= w.batchSize
+	if full {
+		delete(w.buffers, key)
+	}
+	w.lock.Unlock()
+	if full {
+		w.write(b)
+	}
+}
+
+// flushAll write all buffered rows
+func (w *dbWriter) flushAll() {
+	w.lock.Lock()
+	keys := make([]string, 0, len(w.buffers))
+	for key := range w.buffers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	pending := make([]*tableBuffer, 0, len(keys))
+	for _, key := range keys {
+		pending = append(pending, w.buffers[key])
+		delete(w.buffers, key)
+	}
+	w.lock.Unlock()
+	for _, p := range pending {
+		w.write(p)
+	}
+	if len(pending) == 0 && w.spool != nil {
+		w.dbLock.Lock()
+		w.replaySpool()
+		w.dbLock.Unlock()
+	}
+}
+
+// close stop flush loop and write all buffered rows
+func (w *dbWriter) close() {
+	select {
+	case <-w.stop:
+	default:
+		close(w.stop)
+	}
+	w.stopped.Wait()
+	w.flushAll()
+}
+
+// write insert rows with one multi-row insert
+func (w *dbWriter) write(b *tableBuffer) {
+	w.writeEntries(b.tn, &common.Entries{Fields: b.fields, Values: b.values}, b.committed...)
+}
+
+// writeEntries insert the entries. If the spool contains records, they are
+// replayed before to keep the order. A failing replay does not block the
+// new entries. Inserts failing because of the connection are stored in the
+// spool, inserts the database rejects are moved into the quarantine.
+// The committed functions are called after the entries are inserted, also
+// if they are inserted by the spool replay. Returns true if the entries
+// are inserted
+func (w *dbWriter) writeEntries(tn string, entries *common.Entries, committed ...func()) bool {
+	w.dbLock.Lock()
+	defer w.dbLock.Unlock()
+	if rerr := w.replaySpool(); rerr != nil {
+		log.Log.Errorf("Error replaying database spool: %v", rerr)
+	}
+	err := w.timedInsert(tn, entries)
+	if err != nil {
+		services.ServerMessage("Error inserting %d records into %s: %v", len(entries.Values), tn, err)
+		log.Log.Errorf("Error inserting records into %s: %v", tn, err)
+		if w.spool == nil {
+			return false
+		}
+		if isTransientError(err) {
+			err = w.spool.append(tn, entries, committed...)
+		} else {
+			err = w.spool.reject(tn, entries, err)
+		}
+		if err != nil {
+			log.Log.Errorf("Error spooling records of %s: %v", tn, err)
+		}
+		return false
+	}
+	log.Log.Debugf("Flushed %d records into %s", len(entries.Values), tn)
+	for _, c := range committed {
+		c()
+	}
+	return true
+}
+
+// timedInsert insert entries and record the statistics
+func (w *dbWriter) timedInsert(tn string, entries *common.Entries) error {
+	start := time.Now()
+	err := w.insert(tn, entries)
+	getDbStatEntry(tn).flushed(time.Since(start), len(entries.Values), err)
+	if err == nil {
+		touchRollup(tn, entries)
+	}
+	return err
+}
+
+// replaySpool replay spooled records, dbLock need to be hold
+func (w *dbWriter) replaySpool() error {
+	if w.spool == nil || w.spool.pending() == 0 {
+		return nil
+	}
+	return w.spool.replay(w.timedInsert)
+}
+
+// FlushDatabase write all buffered rows, used on shutdown
+func FlushDatabase() {
+	if writer != nil {
+		writer.close()
+	}
+}
+
+// insertTable buffer data to be inserted into the database, long format
+// tables get one row per key. Unchanged rows of change-only tables are skipped
+func insertTable(tn string, data map[string]interface{}, generateColumns func(map[string]interface{}) ([]string, [][]any)) {
+	var committed func()
+	if adapter.DatabaseConfig != nil {
+		var store bool
+		store, committed = adapter.DatabaseConfig.deadband().storeRow(tn, data, time.Now())
+		if !store {
+			log.Log.Debugf("Skip unchanged row of %s", tn)
+			return
+		}
+	}
+	if isLongFormat(tn) {
+		generateColumns = func(data map[string]interface{}) ([]string, [][]any) {
+			return longFormatRows(tn, data)
+		}
+	}
+	fields, values := generateColumns(data)
+	log.Log.Debugf("Insert columnFields: %#v", fields)
+	if len(fields) == 0 || len(values) == 0 {
+		log.Log.Errorf("No fields to insert into %s", tn)
+		return
+	}
+	getWriter().add(tn, fields, values, committed)
+}
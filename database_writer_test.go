@@ -0,0 +1,100 @@
+/*
+* Copyright 2025-2026 Thorsten A. Knieling
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*    http://www.apache.org/licenses/LICENSE-2.0
+*
+ */
+
+package ecoflow2db
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tknie/flynn/common"
+)
+
+func TestDbWriter(t *testing.T) {
+	var lock sync.Mutex
+	inserts := make([]*common.Entries, 0)
+	fail := false
+	w := newDbWriter(3, time.Hour, func(tn string, entries *common.Entries) error {
+		lock.Lock()
+		defer lock.Unlock()
+		if fail {
+			return fmt.Errorf("connection closed")
+		}
+		assert.Equal(t, "test_writer", tn)
+		inserts = append(inserts, entries)
+		return nil
+	})
+	fields := []string{"eco_a", "eco_b"}
+	w.add("test_writer", fields, [][]any{{1, 2}})
+	w.add("test_writer", fields, [][]any{{3, 4}})
+	assert.Len(t, inserts, 0)
+	w.add("test_writer", fields, [][]any{{5, 6}})
+	if assert.Len(t, inserts, 1) {
+		assert.Equal(t, [][]any{{1, 2}, {3, 4}, {5, 6}}, inserts[0].Values)
+	}
+
+	// changed fields are buffered separately
+	w.add("test_writer", fields, [][]any{{7, 8}})
+	w.add("test_writer", []string{"eco_a"}, [][]any{{9}})
+	assert.Len(t, inserts, 1)
+
+	w.start()
+	w.close()
+	if assert.Len(t, inserts, 3) {
+		assert.Equal(t, []string{"eco_a"}, inserts[1].Fields)
+		assert.Equal(t, [][]any{{9}}, inserts[1].Values)
+		assert.Equal(t, fields, inserts[2].Fields)
+		assert.Equal(t, [][]any{{7, 8}}, inserts[2].Values)
+	}
+
+	// committed functions are only called after a successful insert
+	committed := 0
+	fail = true
+	w.add("test_writer", fields, [][]any{{1, 2}}, func() { committed++ })
+	w.flushAll()
+	assert.Equal(t, 0, committed)
+	stat := getDbStatEntry("test_writer")
+	assert.Equal(t, uint64(5), stat.counter.Load())
+	assert.Equal(t, uint64(1), stat.failed.Load())
+	assert.Equal(t, uint64(4), stat.flushes.Load())
+	assert.Contains(t, stat.String(), "flushes 004")
+
+	fail = false
+	w.add("test_writer", fields, [][]any{{3, 4}}, func() { committed++ }, nil)
+	w.flushAll()
+	assert.Equal(t, 1, committed)
+}
+
+func TestDbWriterInterleavedFields(t *testing.T) {
+	inserts := make([]*common.Entries, 0)
+	w := newDbWriter(3, time.Hour, func(tn string, entries *common.Entries) error {
+		inserts = append(inserts, entries)
+		return nil
+	})
+	fieldsA := []string{"eco_a", "eco_serial_number"}
+	fieldsB := []string{"eco_b", "eco_serial_number"}
+	for i := 0; i < 3; i++ {
+		w.add("interleaved_mqtt", fieldsA, [][]any{{i, "A"}})
+		w.add("interleaved_mqtt", fieldsB, [][]any{{i, "B"}})
+	}
+	// one multi-row insert per field set
+	if assert.Len(t, inserts, 2) {
+		assert.Equal(t, fieldsA, inserts[0].Fields)
+		assert.Equal(t, [][]any{{0, "A"}, {1, "A"}, {2, "A"}}, inserts[0].Values)
+		assert.Equal(t, fieldsB, inserts[1].Fields)
+		assert.Equal(t, [][]any{{0, "B"}, {1, "B"}, {2, "B"}}, inserts[1].Values)
+	}
+	w.flushAll()
+	assert.Len(t, inserts, 2)
+}
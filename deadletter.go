@@ -0,0 +1,185 @@
+/*
+* Copyright 2025-2026 Thorsten A. Knieling
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*    http://www.apache.org/licenses/LICENSE-2.0
+*
+ */
+
+package ecoflow2db
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/tknie/log"
+	"github.com/tknie/services"
+)
+
+const defaultDeadLetterMaxSizeKB = 1024
+const defaultDeadLetterMaxFiles = 5
+
+type deadLetterConfig struct {
+	File      string `yaml:"file"`
+	MaxSizeKB int64  `yaml:"maxSizeKB"`
+	MaxFiles  int    `yaml:"maxFiles"`
+	file      *rotatingFile
+}
+
+// deadLetter entry of a MQTT payload which could not be parsed. The payload
+// is kept as string if it is valid UTF-8, otherwise the raw data and a
+// hex dump are stored
+type deadLetter struct {
+	Topic    string    `json:"topic"`
+	Received time.Time `json:"received"`
+	Payload  string    `json:"payload,omitempty"`
+	Raw      []byte    `json:"raw,omitempty"`
+	Dump     string    `json:"dump,omitempty"`
+	Error    string    `json:"error"`
+}
+
+var deadLetterLock sync.Mutex
+
+// data raw payload of the dead-letter entry
+func (dl *deadLetter) data() []byte {
+	if dl.Raw != nil {
+		return dl.Raw
+	}
+	return []byte(dl.Payload)
+}
+
+// fileName dead-letter file name with environment resolved
+func (dlc *deadLetterConfig) fileName() string {
+	return os.ExpandEnv(dlc.File)
+}
+
+// storeDeadLetter store the unparsable payload into the dead-letter file
+func storeDeadLetter(topic string, payload []byte, perr error) {
+	if adapter.Mqtt == nil || adapter.Mqtt.DeadLetter == nil || adapter.Mqtt.DeadLetter.File == "" {
+		fmt.Println("Payload parse fails:", perr)
+		fmt.Println("Payload parse fails for payload:", string(payload))
+		return
+	}
+	dl := &deadLetter{Topic: topic, Received: time.Now(), Error: perr.Error()}
+	if utf8.Valid(payload) {
+		dl.Payload = string(payload)
+	} else {
+		dl.Raw = payload
+		dl.Dump = FormatByteBuffer("MQTT payload", payload)
+	}
+	err := adapter.Mqtt.DeadLetter.write(dl)
+	if err != nil {
+		services.ServerMessage("Error writing dead-letter entry of %s: %v", topic, err)
+		return
+	}
+	deadLetterCounter.Add(1)
+	log.Log.Errorf("Dead-letter entry of topic %s stored: %v", topic, perr)
+}
+
+// write append the entry to the dead-letter file and rotate if
+// the maximum size is reached
+func (dlc *deadLetterConfig) write(dl *deadLetter) error {
+	b, err := json.Marshal(dl)
+	if err != nil {
+		return err
+	}
+	deadLetterLock.Lock()
+	if dlc.file == nil {
+		maxSize := dlc.MaxSizeKB
+		if maxSize == 0 {
+			maxSize = defaultDeadLetterMaxSizeKB
+		}
+		maxFiles := dlc.MaxFiles
+		if maxFiles == 0 {
+			maxFiles = defaultDeadLetterMaxFiles
+		}
+		dlc.file = newRotatingFile(dlc.File, maxSize*1024, 0, maxFiles)
+	}
+	deadLetterLock.Unlock()
+	return dlc.file.writeLine(b)
+}
+
+// readDeadLetters read all dead-letter entries, oldest first
+func (dlc *deadLetterConfig) readDeadLetters(f func(dl *deadLetter) error) error {
+	return readLines(allFiles(dlc.fileName()), func(name string, line []byte) error {
+		dl := &deadLetter{}
+		err := json.Unmarshal(line, dl)
+		if err != nil {
+			log.Log.Errorf("Skip invalid dead-letter line in %s: %v", name, err)
+			return nil
+		}
+		return f(dl)
+	})
+}
+
+func deadLetterConfigured() *deadLetterConfig {
+	if adapter.Mqtt == nil || adapter.Mqtt.DeadLetter == nil || adapter.Mqtt.DeadLetter.File == "" {
+		fmt.Println("No dead-letter file configured")
+		return nil
+	}
+	return adapter.Mqtt.DeadLetter
+}
+
+// ListDeadLetters list all dead-letter entries
+func ListDeadLetters() {
+	dlc := deadLetterConfigured()
+	if dlc == nil {
+		return
+	}
+	counter := 0
+	err := dlc.readDeadLetters(func(dl *deadLetter) error {
+		counter++
+		fmt.Printf("%04d %s %s: %s\n", counter, dl.Received.Format(layout), dl.Topic, dl.Error)
+		if dl.Dump != "" {
+			fmt.Print(dl.Dump)
+		} else {
+			fmt.Println(dl.Payload)
+		}
+		return nil
+	})
+	if err != nil {
+		fmt.Println("Error reading dead-letter entries:", err)
+	}
+	fmt.Printf("%d dead-letter entries found\n", counter)
+}
+
+// ReplayDeadLetters parse all dead-letter entries again with the current
+// topic mapping, the result is only displayed
+func ReplayDeadLetters() {
+	dlc := deadLetterConfigured()
+	if dlc == nil {
+		return
+	}
+	topicMap := adapter.topicMap()
+	counter := 0
+	failed := 0
+	err := dlc.readDeadLetters(func(dl *deadLetter) error {
+		counter++
+		topic, ok := topicMap[dl.Topic]
+		if !ok {
+			failed++
+			fmt.Printf("%04d %s: topic not configured\n", counter, dl.Topic)
+			return nil
+		}
+		x, err := topic.parsePayload(dl.data())
+		if err != nil {
+			failed++
+			fmt.Printf("%04d %s: still fails: %v\n", counter, dl.Topic, err)
+			return nil
+		}
+		em := topic.ParseMessage(x)
+		fmt.Printf("%04d %s: %v\n", counter, dl.Topic, em)
+		return nil
+	})
+	if err != nil {
+		fmt.Println("Error reading dead-letter entries:", err)
+	}
+	fmt.Printf("%d dead-letter entries replayed, %d failed\n", counter, failed)
+}
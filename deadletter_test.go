@@ -0,0 +1,55 @@
+/*
+* Copyright 2025-2026 Thorsten A. Knieling
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*    http://www.apache.org/licenses/LICENSE-2.0
+*
+ */
+
+package ecoflow2db
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeadLetterRotate(t *testing.T) {
+	dlc := &deadLetterConfig{File: filepath.Join(t.TempDir(), "dead.jsonl"), MaxSizeKB: 1, MaxFiles: 2}
+	// files of the user are not rotated files
+	for _, suffix := range []string{"bak", "gz", "20250601-120000.000000.gz"} {
+		assert.NoError(t, os.WriteFile(dlc.File+"."+suffix, []byte("keep"), 0644))
+	}
+	for i := 0; i < 40; i++ {
+		err := dlc.write(&deadLetter{Topic: "tele/meter", Received: time.Now(),
+			Payload: fmt.Sprintf("{\"nr\":%d,", i), Error: "unexpected end of JSON input"})
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, dlc.write(&deadLetter{Topic: "tele/meter", Raw: []byte{0x0a, 0xff, 0x01}}))
+	entries := make([]*deadLetter, 0)
+	err := dlc.readDeadLetters(func(dl *deadLetter) error {
+		entries = append(entries, dl)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Less(t, len(entries), 41)
+	assert.Greater(t, len(entries), 10)
+	last := entries[len(entries)-1]
+	assert.Equal(t, []byte{0x0a, 0xff, 0x01}, last.data())
+	assert.Equal(t, "{\"nr\":39,", entries[len(entries)-2].Payload)
+	assert.Len(t, rotatedFiles(dlc.File), 2)
+	for _, suffix := range []string{"bak", "gz", "20250601-120000.000000.gz"} {
+		assert.FileExists(t, dlc.File+"."+suffix)
+	}
+	assert.True(t, isRotateSuffix("20250601-120000.000000"))
+	assert.True(t, isRotateSuffix("20250601-120000.000000-2"))
+	assert.False(t, isRotateSuffix("20250601-120000.000000-x"))
+	assert.False(t, isRotateSuffix("bak"))
+}
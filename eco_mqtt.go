@@ -60,6 +60,7 @@ func insertMqttData(data map[string]interface{}) ([]string, [][]any) {
 		default:
 			services.ServerMessage("Unknown type %s=%T", k, v)
 			log.Log.Errorf("Unknown type %s=%T", k, v)
+			columns = append(columns, nil)
 		}
 	}
 	return fields, [][]any{columns}
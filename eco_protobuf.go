@@ -0,0 +1,343 @@
+/*
+* Copyright 2025-2026 Thorsten A. Knieling
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*    http://www.apache.org/licenses/LICENSE-2.0
+*
+ */
+
+package ecoflow2db
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/tknie/ecoflow"
+	"github.com/tknie/log"
+	"github.com/tknie/services"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// frameKey identify the message type of a frame
+type frameKey struct {
+	cmdFunc int32
+	cmdID   int32
+}
+
+// frameDecoder decode the frame payload into flat key/value map, all keys
+// are prefixed by the decoder name
+type frameDecoder struct {
+	name   string
+	decode func(name string, pdata []byte) (map[string]interface{}, error)
+}
+
+type fieldKind byte
+
+const (
+	fieldUint fieldKind = iota
+	fieldInt
+	fieldFloat
+)
+
+type protoField struct {
+	name string
+	kind fieldKind
+}
+
+// bmsHeartbeatFields field numbers of the BMS heartbeat report
+var bmsHeartbeatFields = map[protowire.Number]protoField{
+	1:  {"num", fieldUint},
+	2:  {"type", fieldUint},
+	3:  {"cellId", fieldUint},
+	4:  {"errCode", fieldUint},
+	5:  {"sysVer", fieldUint},
+	6:  {"soc", fieldUint},
+	7:  {"vol", fieldUint},
+	8:  {"amp", fieldInt},
+	9:  {"temp", fieldInt},
+	10: {"openBmsIdx", fieldUint},
+	11: {"designCap", fieldUint},
+	12: {"remainCap", fieldUint},
+	13: {"fullCap", fieldUint},
+	14: {"cycles", fieldUint},
+	15: {"soh", fieldUint},
+	16: {"maxCellVol", fieldUint},
+	17: {"minCellVol", fieldUint},
+	18: {"maxCellTemp", fieldInt},
+	19: {"minCellTemp", fieldInt},
+	20: {"maxMosTemp", fieldInt},
+	21: {"minMosTemp", fieldInt},
+	22: {"bmsFault", fieldUint},
+	23: {"bqSysStatReg", fieldUint},
+	24: {"tagChgAmp", fieldUint},
+	25: {"f32ShowSoc", fieldFloat},
+	26: {"inputWatts", fieldUint},
+	27: {"outputWatts", fieldUint},
+	28: {"remainTime", fieldUint},
+}
+
+// frameDecoders all known frame types
+var frameDecoders = map[frameKey]*frameDecoder{
+	{cmdFunc: 20, cmdID: 1}: {name: "heartbeat", decode: messageDecoder(func() proto.Message {
+		return &ecoflow.InverterHeartbeat{}
+	})},
+	{cmdFunc: 32, cmdID: 50}: {name: "bms", decode: fieldTableDecoder(bmsHeartbeatFields)},
+}
+
+// messageDecoder decoder using generated protobuf message
+func messageDecoder(create func() proto.Message) func(string, []byte) (map[string]interface{}, error) {
+	return func(name string, pdata []byte) (map[string]interface{}, error) {
+		m := create()
+		err := proto.Unmarshal(pdata, m)
+		if err != nil {
+			return nil, err
+		}
+		data := make(map[string]interface{})
+		flattenMessage(name, m.ProtoReflect(), data)
+		return data, nil
+	}
+}
+
+// flattenMessage add all set fields of the message into the map
+func flattenMessage(prefix string, m protoreflect.Message, data map[string]interface{}) {
+	m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		name := prefix + "." + fd.JSONName()
+		if fd.IsList() || fd.IsMap() {
+			log.Log.Debugf("Skip repeated field %s", name)
+			return true
+		}
+		switch fd.Kind() {
+		case protoreflect.MessageKind, protoreflect.GroupKind:
+			flattenMessage(name, v.Message(), data)
+		case protoreflect.BoolKind:
+			// stored as number like all other protobuf scalars
+			data[name] = 0.0
+			if v.Bool() {
+				data[name] = 1.0
+			}
+		case protoreflect.StringKind:
+			data[name] = v.String()
+		case protoreflect.BytesKind:
+			data[name] = hex.EncodeToString(v.Bytes())
+		case protoreflect.EnumKind:
+			data[name] = float64(v.Enum())
+		case protoreflect.FloatKind, protoreflect.DoubleKind:
+			data[name] = v.Float()
+		case protoreflect.Uint32Kind, protoreflect.Uint64Kind,
+			protoreflect.Fixed32Kind, protoreflect.Fixed64Kind:
+			data[name] = float64(v.Uint())
+		default:
+			data[name] = float64(v.Int())
+		}
+		return true
+	})
+}
+
+// fieldTableDecoder decoder for messages without generated protobuf
+// message using the field number table
+func fieldTableDecoder(fields map[protowire.Number]protoField) func(string, []byte) (map[string]interface{}, error) {
+	return func(name string, pdata []byte) (map[string]interface{}, error) {
+		data := make(map[string]interface{})
+		b := pdata
+		for len(b) > 0 {
+			num, typ, n := protowire.ConsumeTag(b)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			b = b[n:]
+			pf, known := fields[num]
+			var value interface{}
+			switch typ {
+			case protowire.VarintType:
+				v, n := protowire.ConsumeVarint(b)
+				if n < 0 {
+					return nil, protowire.ParseError(n)
+				}
+				b = b[n:]
+				if pf.kind == fieldInt {
+					value = float64(int32(v))
+				} else {
+					value = float64(v)
+				}
+			case protowire.Fixed32Type:
+				v, n := protowire.ConsumeFixed32(b)
+				if n < 0 {
+					return nil, protowire.ParseError(n)
+				}
+				b = b[n:]
+				if pf.kind == fieldFloat {
+					value = float64(math.Float32frombits(v))
+				} else {
+					value = float64(v)
+				}
+			default:
+				n := protowire.ConsumeFieldValue(num, typ, b)
+				if n < 0 {
+					return nil, protowire.ParseError(n)
+				}
+				b = b[n:]
+			}
+			if !known || value == nil {
+				log.Log.Debugf("Unknown field %s.%d type %d", name, num, typ)
+				continue
+			}
+			data[name+"."+pf.name] = value
+		}
+		return data, nil
+	}
+}
+
+// decodeHeaders decode all headers contained in the payload
+func decodeHeaders(payload []byte) ([]*ecoflow.Header, error) {
+	headers := make([]*ecoflow.Header, 0)
+	b := payload
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		b = b[n:]
+		if num == 1 && typ == protowire.BytesType {
+			v, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			b = b[n:]
+			h := &ecoflow.Header{}
+			err := proto.Unmarshal(v, h)
+			if err != nil {
+				return nil, err
+			}
+			headers = append(headers, h)
+			continue
+		}
+		n = protowire.ConsumeFieldValue(num, typ, b)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		b = b[n:]
+	}
+	return headers, nil
+}
+
+// framePayload payload data of the header, XOR encoded payload are decoded
+// with the sequence number
+func framePayload(h *ecoflow.Header) []byte {
+	pdata := h.GetPdata()
+	if h.GetEncType() != 1 || h.GetSrc() == 32 {
+		return pdata
+	}
+	decoded := make([]byte, len(pdata))
+	for i, b := range pdata {
+		decoded[i] = b ^ byte(h.GetSeq())
+	}
+	return decoded
+}
+
+// decodeFrames decode all known frames of the binary payload. Unknown
+// frames are logged with the payload dump
+func decodeFrames(sn string, payload []byte) ([]map[string]interface{}, error) {
+	headers, err := decodeHeaders(payload)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]map[string]interface{}, 0)
+	for _, h := range headers {
+		key := frameKey{cmdFunc: h.GetCmdFunc(), cmdID: h.GetCmdId()}
+		pdata := framePayload(h)
+		decoder, ok := frameDecoders[key]
+		if !ok {
+			protobufStat(fmt.Sprintf("unknown_%d_%d", key.cmdFunc, key.cmdID))
+			log.Log.Infof("Unknown frame cmdFunc=%d cmdId=%d of %s: %s", key.cmdFunc, key.cmdID, sn,
+				FormatByteBuffer("Frame pdata", pdata))
+			continue
+		}
+		data, err := decoder.decode(decoder.name, pdata)
+		if err != nil {
+			protobufStat(decoder.name + "_error")
+			log.Log.Errorf("Error decoding frame %s of %s: %v %s", decoder.name, sn, err,
+				FormatByteBuffer("Frame pdata", pdata))
+			continue
+		}
+		protobufStat(decoder.name)
+		result = append(result, data)
+	}
+	return result, nil
+}
+
+// privateMessageHandler handle messages of the private Ecoflow MQTT stream,
+// JSON messages are handled by the Ecoflow library, binary protobuf frames
+// are decoded and passed to the Callback
+func privateMessageHandler(c mqtt.Client, msg mqtt.Message) {
+	payload := msg.Payload()
+	if json.Valid(payload) {
+		ecoflow.MessageHandler(c, msg)
+		return
+	}
+	topic := strings.Split(msg.Topic(), "/")
+	sn := topic[len(topic)-1]
+	frames, err := decodeFrames(sn, payload)
+	if err != nil {
+		protobufStat("invalid")
+		log.Log.Errorf("Error decoding protobuf payload of %s: %v %s", sn, err,
+			FormatByteBuffer("MQTT Body", payload))
+		return
+	}
+	for _, data := range frames {
+		if _, ok := data["serial_number"]; !ok {
+			data["serial_number"] = sn
+		}
+		if _, ok := data["timestamp"]; !ok {
+			data["timestamp"] = time.Now()
+		}
+		ecoflow.Callback(sn, data)
+	}
+}
+
+// initPrivateMqtt connect to the private Ecoflow MQTT stream and subscribe
+// all devices with the protobuf aware message handler
+func initPrivateMqtt(user, password string) {
+	configuration := ecoflow.MqttClientConfiguration{
+		Email:    user,
+		Password: password,
+		OnConnect: func(mqtt.Client) {
+			devices := client.GetDevices()
+			if devices == nil {
+				log.Log.Errorf("No devices found to subscribe")
+				return
+			}
+			for _, d := range devices.Devices {
+				services.ServerMessage("Subscribe for MQTT entries of device %s", d.SN)
+				err := ecoClient.SubscribeForParameters(d.SN, privateMessageHandler)
+				if err != nil {
+					log.Log.Errorf("Unable to subscribe for parameters %s: %v", d.SN, err)
+				}
+			}
+		},
+		OnConnectionLost: ecoflow.OnConnectionLost,
+		OnReconnect:      ecoflow.OnReconnect,
+	}
+	var err error
+	ecoClient, err = ecoflow.NewMqttClient(context.Background(), configuration)
+	if err != nil {
+		services.ServerMessage("Shuting down ... error creating MQTT client: %v", err)
+		log.Log.Fatalf("Error creating new MQTT client connection: %v", err)
+	}
+	err = ecoClient.Connect()
+	if err != nil {
+		services.ServerMessage("Error connecting Ecoflow MQTT: %v", err)
+		return
+	}
+	services.ServerMessage("Waiting for MQTT data")
+}
@@ -0,0 +1,74 @@
+/*
+* Copyright 2025-2026 Thorsten A. Knieling
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*    http://www.apache.org/licenses/LICENSE-2.0
+*
+ */
+
+package ecoflow2db
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tknie/ecoflow"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func frame(t *testing.T, h *ecoflow.Header) []byte {
+	b, err := proto.Marshal(h)
+	assert.NoError(t, err)
+	return protowire.AppendBytes(protowire.AppendTag(nil, 1, protowire.BytesType), b)
+}
+
+func TestDecodeFrames(t *testing.T) {
+	ih := &ecoflow.InverterHeartbeat{Pv1InputWatts: proto.Int32(1234), BatSoc: proto.Uint32(87),
+		BatInputWatts: proto.Int32(-150), InstallCountry: proto.String("DE")}
+	pdata, err := proto.Marshal(ih)
+	assert.NoError(t, err)
+	payload := frame(t, &ecoflow.Header{Pdata: pdata, CmdFunc: proto.Int32(20), CmdId: proto.Int32(1)})
+
+	bms := protowire.AppendTag(nil, 6, protowire.VarintType)
+	bms = protowire.AppendVarint(bms, 55)
+	bms = protowire.AppendTag(bms, 9, protowire.VarintType)
+	temp := int64(-3)
+	bms = protowire.AppendVarint(bms, uint64(temp))
+	bms = protowire.AppendTag(bms, 99, protowire.VarintType)
+	bms = protowire.AppendVarint(bms, 1)
+	// XOR encoded with sequence number
+	seq := int32(0x5a)
+	encoded := make([]byte, len(bms))
+	for i, b := range bms {
+		encoded[i] = b ^ byte(seq)
+	}
+	payload = append(payload, frame(t, &ecoflow.Header{Pdata: encoded, CmdFunc: proto.Int32(32),
+		CmdId: proto.Int32(50), EncType: proto.Int32(1), Src: proto.Int32(3), Seq: proto.Int32(seq)})...)
+	payload = append(payload, frame(t, &ecoflow.Header{Pdata: []byte{1, 2, 3},
+		CmdFunc: proto.Int32(254), CmdId: proto.Int32(17)})...)
+
+	frames, err := decodeFrames("HW51TEST", payload)
+	assert.NoError(t, err)
+	if assert.Len(t, frames, 2) {
+		assert.Equal(t, map[string]interface{}{"heartbeat.pv1InputWatts": float64(1234),
+			"heartbeat.batSoc": float64(87), "heartbeat.batInputWatts": float64(-150),
+			"heartbeat.installCountry": "DE"}, frames[0])
+		assert.Equal(t, map[string]interface{}{"bms.soc": float64(55), "bms.temp": float64(-3)}, frames[1])
+	}
+
+	_, err = decodeFrames("HW51TEST", []byte{0x0a, 0xff})
+	assert.Error(t, err)
+
+	// bools are stored as 0 and 1
+	data := make(map[string]interface{})
+	flattenMessage("flag", wrapperspb.Bool(true).ProtoReflect(), data)
+	assert.Equal(t, map[string]interface{}{"flag.value": 1.0}, data)
+	fields, values := insertMqttData(data)
+	assert.Equal(t, []string{"eco_flag_value"}, fields)
+	assert.Equal(t, [][]any{{int64(1)}}, values)
+}
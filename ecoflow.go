@@ -25,6 +25,7 @@ import (
 var mqttid common.RegDbID
 var MqttDisable = false
 var client *ecoflow.Client
+var ecoClient *ecoflow.MqttClient
 
 func prepareEcoflow() {
 
@@ -57,6 +58,7 @@ func prepareEcoflow() {
 // InitEcoflow init ecoflow MQTT
 func InitEcoflow() {
 	adapter.ConnectMQTT()
+	adapter.StartMeters()
 	prepareEcoflow()
 	user := adapter.EcoflowConfig.User
 	password := adapter.EcoflowConfig.Password
@@ -80,13 +82,15 @@ func InitMqtt(user, password string) {
 	mqttid = connnectDatabase()
 	log.Log.Debugf("Connecting MQTT Ecoflow connect")
 	services.ServerMessage("Connecting MQTT client")
-	ecoflow.InitMqtt(user, password)
+	initPrivateMqtt(user, password)
 	log.Log.Debugf("Wait for Ecoflow disconnect")
 }
 
-func SetEnvironmentPowerConsumption(value float64) {
+// SetEnvironmentPowerConsumption write the power request using the
+// configured actuator
+func SetEnvironmentPowerConsumption(value float64) error {
 	prepareEcoflow()
-	client.SetEnvironmentPowerConsumption(adapter.EcoflowConfig.MicroConverter[0], value)
+	return setPowerRequest(powerTarget(), value)
 }
 
 func SetCarACOn(sn string, turnOn bool) {
@@ -34,6 +34,8 @@ func setupGracefulShutdown(done chan bool) {
 		services.ServerMessage("Shutdown signal received: %s", s)
 
 		endHttp()
+		FlushDatabase()
+		disconnectMQTT()
 		close(quit)
 		done <- true
 	}()
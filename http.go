@@ -67,9 +67,11 @@ func httpParameterStore(client *ecoflow.Client) {
 			log.Log.Errorf("Error getting device parameter sn=%s: %v", l.SN, err)
 			continue
 		}
+		announceHomeAssistant(l.SN, resp)
+		resp = filterKeys(l.SN, resp)
 
 		// Check, create and write into table
-		checkTable(id, adapter.DatabaseConfig.Table, func() []*common.Column {
+		checkTable(&id, adapter.DatabaseConfig.Table, func() []*common.Column {
 			keys := make([]string, 0, len(resp))
 			for k := range resp {
 				keys = append(keys, k)
@@ -119,12 +121,9 @@ func httpParameterStore(client *ecoflow.Client) {
 					if _, ok := resp["timestamp"]; !ok {
 						resp["timestamp"] = time.Now()
 					}
-					checkTableColumns(id, tn, resp)
-					err = insertTable(id, tn, resp, insertHttpData)
-					if err != nil && strings.Contains(err.Error(), "conn closed") {
-						id.Close()
-						id = connnectDatabase()
-					}
+					stored := filterKeys(l.SN, resp)
+					checkTableColumns(&id, tn, stored)
+					insertTable(tn, stored, insertHttpData)
 					httpCounter++
 					status, ok := statusChange[l.SN]
 					if !ok {
@@ -143,6 +142,8 @@ func httpParameterStore(client *ecoflow.Client) {
 							services.ServerMessage("'%s' device is getting online", l.SN)
 						}
 					}
+					publishDeviceState(l.SN, resp, statusChange[l.SN])
+					publishHomeAssistantState(l.SN, resp)
 				}
 			}
 		}
@@ -189,9 +190,18 @@ func createValueColumn(name string, v interface{}) *common.Column {
 	return nil
 }
 
-// checkTableColumns check if new parameters are in current request to adapt table
-func checkTableColumns(id common.RegDbID, tn string, data map[string]interface{}) {
-	col, err := id.GetTableColumn(tn)
+// checkTableColumns check if new parameters are in current request to adapt table,
+// columns the new values do not fit into are widened. The handle is
+// reconnected if the connection is broken
+func checkTableColumns(id *common.RegDbID, tn string, data map[string]interface{}) {
+	if isLongFormat(tn) {
+		return
+	}
+	var col []string
+	err := schemaCall(id, func(id common.RegDbID) (err error) {
+		col, err = id.GetTableColumn(tn)
+		return err
+	})
 	if err != nil {
 		services.ServerMessage("Get table column %v", err)
 		return
@@ -208,9 +218,15 @@ func checkTableColumns(id common.RegDbID, tn string, data map[string]interface{}
 	}
 	if len(columns) > 0 {
 		log.Log.Debugf("Add %d. columns to table %T", len(columns), columns)
-		err = id.AdaptTable(tn, columns)
+		err = schemaCall(id, func(id common.RegDbID) error {
+			return id.AdaptTable(tn, columns)
+		})
 		log.Log.Debugf("Added %d. columns to table: %v", len(columns), err)
+		if err == nil {
+			forgetColumns(tn)
+		}
 	}
+	widenColumns(id, tn, data)
 }
 
 // insertHttpData prepare database data to be inserted into the database
@@ -263,7 +279,8 @@ func endHttp() {
 
 func Callback(serialNumber string, data map[string]interface{}) {
 	tn := fmt.Sprintf("%s_mqtt", serialNumber)
-	if !checkTable(mqttid, tn, func() []*common.Column {
+	data = filterKeys(serialNumber, data)
+	if !checkTable(&mqttid, tn, func() []*common.Column {
 		keys := make([]string, 0, len(data))
 		for k := range data {
 			keys = append(keys, k)
@@ -280,12 +297,7 @@ func Callback(serialNumber string, data map[string]interface{}) {
 		}
 		return columns
 	}) {
-		checkTableColumns(mqttid, tn, data)
-	}
-	err := insertTable(mqttid, tn, data, insertMqttData)
-	if err != nil && strings.Contains(err.Error(), "conn closed") {
-		// Connection is closed reconnect
-		mqttid.Close()
-		mqttid = connnectDatabase()
+		checkTableColumns(&mqttid, tn, data)
 	}
+	insertTable(tn, data, insertMqttData)
 }
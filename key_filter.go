@@ -0,0 +1,93 @@
+/*
+* Copyright 2025-2026 Thorsten A. Knieling
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*    http://www.apache.org/licenses/LICENSE-2.0
+*
+ */
+
+package ecoflow2db
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/tknie/log"
+)
+
+// keyFilter include and exclude glob patterns of the quota keys stored for
+// the devices. Devices are given by serial number patterns, a device model
+// is selected by its serial number prefix like "HW51*". Without device
+// pattern the filter is used for all devices
+type keyFilter struct {
+	Devices []string `yaml:"devices"`
+	Include []string `yaml:"include"`
+	Exclude []string `yaml:"exclude"`
+}
+
+// validate check all glob patterns
+func (kf *keyFilter) validate() error {
+	for _, list := range [][]string{kf.Devices, kf.Include, kf.Exclude} {
+		for _, p := range list {
+			if _, err := path.Match(p, ""); err != nil {
+				return fmt.Errorf("invalid key filter pattern '%s'", p)
+			}
+		}
+	}
+	return nil
+}
+
+// matchAny check if one of the patterns matches
+func matchAny(patterns []string, s string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, s); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// device check if the filter is used for the serial number
+func (kf *keyFilter) device(sn string) bool {
+	return len(kf.Devices) == 0 || matchAny(kf.Devices, sn)
+}
+
+// keep check if the key is stored
+func (kf *keyFilter) keep(key string) bool {
+	if key == "timestamp" || key == "serial_number" {
+		return true
+	}
+	if len(kf.Include) > 0 && !matchAny(kf.Include, key) {
+		return false
+	}
+	return !matchAny(kf.Exclude, key)
+}
+
+// filterKeys data with the keys to be stored of the device, the first
+// filter matching the serial number is used. The data is copied if keys
+// are removed, the original data is used for publishing
+func filterKeys(sn string, data map[string]interface{}) map[string]interface{} {
+	if adapter.DatabaseConfig == nil {
+		return data
+	}
+	for _, kf := range adapter.DatabaseConfig.keyFilters() {
+		if !kf.device(sn) {
+			continue
+		}
+		filtered := make(map[string]interface{}, len(data))
+		for k, v := range data {
+			if kf.keep(k) {
+				filtered[k] = v
+			}
+		}
+		if len(filtered) < len(data) {
+			log.Log.Debugf("Filtered %d keys of %s", len(data)-len(filtered), sn)
+			return filtered
+		}
+		return data
+	}
+	return data
+}
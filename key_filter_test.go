@@ -0,0 +1,42 @@
+/*
+* Copyright 2025-2026 Thorsten A. Knieling
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*    http://www.apache.org/licenses/LICENSE-2.0
+*
+ */
+
+package ecoflow2db
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilterKeys(t *testing.T) {
+	old := adapter.DatabaseConfig
+	defer func() { adapter.DatabaseConfig = old }()
+	adapter.DatabaseConfig = &databaseConfig{KeyFilters: []*keyFilter{
+		{Devices: []string{"HW51*"}, Include: []string{"20_1.*"}, Exclude: []string{"20_1.*Temp"}},
+		{Exclude: []string{"*task*"}},
+	}}
+	for _, kf := range adapter.DatabaseConfig.KeyFilters {
+		assert.NoError(t, kf.validate())
+	}
+	data := map[string]interface{}{"serial_number": "HW51ABC", "20_1.pv1InputWatts": 10.0,
+		"20_1.invTemp": 30.0, "20_134.task1": "x"}
+	assert.Equal(t, map[string]interface{}{"serial_number": "HW51ABC", "20_1.pv1InputWatts": 10.0},
+		filterKeys("HW51ABC", data))
+	assert.Len(t, data, 4)
+
+	data = map[string]interface{}{"pd.watts": 1.0, "pd.taskList": "[]"}
+	assert.Equal(t, map[string]interface{}{"pd.watts": 1.0}, filterKeys("R331ABC", data))
+	data = map[string]interface{}{"pd.watts": 1.0}
+	assert.Equal(t, data, filterKeys("R331ABC", data))
+
+	assert.Error(t, (&keyFilter{Include: []string{"["}}).validate())
+}
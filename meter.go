@@ -0,0 +1,142 @@
+/*
+* Copyright 2025-2026 Thorsten A. Knieling
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*    http://www.apache.org/licenses/LICENSE-2.0
+*
+ */
+
+package ecoflow2db
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/eclipse/paho.golang/paho"
+	"github.com/tknie/log"
+	"github.com/tknie/services"
+)
+
+const defaultMeterIntervalMs = 1000
+
+// meterSource meter polled by the application. The reading is pushed
+// into the ingest queue using the topic name and parsed with the topic
+// mapping like MQTT messages
+type meterSource interface {
+	topic() *Topic
+	source() string
+	poller() *meterPoll
+	read() ([]byte, error)
+}
+
+// meterPoll poll interval and statistics of a meter source
+type meterPoll struct {
+	IntervalMs int `yaml:"intervalMs"`
+	TimeoutMs  int `yaml:"timeoutMs"`
+	polls      atomic.Uint64
+	failed     atomic.Uint64
+	failing    atomic.Bool
+}
+
+func (mp *meterPoll) poller() *meterPoll {
+	return mp
+}
+
+// interval poll interval of the meter
+func (mp *meterPoll) interval() time.Duration {
+	if mp.IntervalMs <= 0 {
+		return defaultMeterIntervalMs * time.Millisecond
+	}
+	return time.Duration(mp.IntervalMs) * time.Millisecond
+}
+
+// timeout request timeout, default is the poll interval but at
+// least one second
+func (mp *meterPoll) timeout() time.Duration {
+	if mp.TimeoutMs > 0 {
+		return time.Duration(mp.TimeoutMs) * time.Millisecond
+	}
+	if mp.interval() < time.Second {
+		return time.Second
+	}
+	return mp.interval()
+}
+
+// pollMeter read the meter once and push the reading into the ingest queue
+func pollMeter(m meterSource, q *ingestQueue) {
+	mp := m.poller()
+	name := m.topic().Name
+	mp.polls.Add(1)
+	payload, err := m.read()
+	if err != nil {
+		mp.failed.Add(1)
+		if !mp.failing.Swap(true) {
+			services.ServerMessage("Error polling meter %s: %v", name, err)
+		}
+		log.Log.Errorf("Error polling meter %s: %v", name, err)
+		return
+	}
+	if mp.failing.Swap(false) {
+		services.ServerMessage("Polling meter %s is working again", name)
+	}
+	q.push(&paho.Publish{Topic: name, Payload: payload}, m.topic().queuePolicy())
+}
+
+// loopMeter poll the meter in the configured interval
+func loopMeter(m meterSource, q *ingestQueue) {
+	interval := m.poller().interval()
+	services.ServerMessage("Poll meter %s each %v from %s", m.topic().Name, interval, m.source())
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		pollMeter(m, q)
+		<-ticker.C
+	}
+}
+
+// meterString statistic output of the meter
+func meterString(m meterSource) string {
+	mp := m.poller()
+	return fmt.Sprintf("meter %s polls %03d errors %03d ", m.topic().Name, mp.polls.Load(), mp.failed.Load())
+}
+
+// meterSources all configured meter sources
+func (config *adapterConfig) meterSources() []meterSource {
+	sources := make([]meterSource, 0)
+	if config.Meters == nil {
+		return sources
+	}
+	for _, m := range config.Meters.HTTP {
+		sources = append(sources, m)
+	}
+	for _, m := range config.Meters.Modbus {
+		sources = append(sources, m)
+	}
+	return sources
+}
+
+// StartMeters start all polling meter sources. If no MQTT connection
+// is active, the analyze loop is started for the meter readings
+func (config *adapterConfig) StartMeters() {
+	sources := config.meterSources()
+	if len(sources) == 0 {
+		return
+	}
+	if mqttQueue == nil {
+		getMqttCurrentRequest()
+		queueSize := DefaultQueueSize
+		if config.Mqtt != nil {
+			config.Mqtt.Record.startRecorder()
+			queueSize = config.Mqtt.QueueSize
+		}
+		mqttQueue = newIngestQueue(queueSize)
+		go loopIncomingMessages(mqttQueue, config.topicMap())
+	}
+	for _, m := range sources {
+		go loopMeter(m, mqttQueue)
+	}
+}
@@ -0,0 +1,62 @@
+/*
+* Copyright 2025-2026 Thorsten A. Knieling
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*    http://www.apache.org/licenses/LICENSE-2.0
+*
+ */
+
+package ecoflow2db
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+)
+
+// httpMeter meter source polling a local HTTP JSON endpoint like the
+// Shelly /status or Tasmota cm?cmnd=Status%2010 API. The topic name is used
+// as message topic, the payload is parsed with the topic mapping
+type httpMeter struct {
+	URL       string `yaml:"url"`
+	Username  string `yaml:"username"`
+	Password  string `yaml:"password"`
+	meterPoll `yaml:",inline"`
+	Topic     `yaml:",inline"`
+	client    *http.Client
+}
+
+func (m *httpMeter) topic() *Topic {
+	return &m.Topic
+}
+
+func (m *httpMeter) source() string {
+	return m.URL
+}
+
+// read request the meter endpoint and return the body
+func (m *httpMeter) read() ([]byte, error) {
+	if m.client == nil {
+		m.client = &http.Client{Timeout: m.timeout()}
+	}
+	req, err := http.NewRequest(http.MethodGet, os.ExpandEnv(m.URL), nil)
+	if err != nil {
+		return nil, err
+	}
+	if m.Username != "" {
+		req.SetBasicAuth(m.Username, os.ExpandEnv(m.Password))
+	}
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP status %s", resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
@@ -0,0 +1,69 @@
+/*
+* Copyright 2025-2026 Thorsten A. Knieling
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*    http://www.apache.org/licenses/LICENSE-2.0
+*
+ */
+
+package ecoflow2db
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTPMeterPoll(t *testing.T) {
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, ok := r.BasicAuth()
+		if !ok || user != "admin" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(status)
+		w.Write([]byte(`{"StatusSNS":{"Time":"2025-06-01T12:30:15","SML":{"Power_curr":-150,"Total_in":10.5}}}`))
+	}))
+	defer server.Close()
+
+	m := &httpMeter{URL: server.URL + "/cm?cmnd=Status%2010", Username: "admin", Password: "secret",
+		Topic: Topic{Name: "http/tasmota", Preset: "tasmota-sml", Root: "StatusSNS"}}
+	assert.NoError(t, m.applyPreset())
+	config := &adapterConfig{Meters: &meterConfig{HTTP: []*httpMeter{m}}}
+	topicMap := config.topicMap()
+	assert.Equal(t, &m.Topic, topicMap["http/tasmota"])
+
+	q := newIngestQueue(5)
+	pollMeter(m, q)
+	assert.Equal(t, uint64(1), m.polls.Load())
+	assert.Equal(t, uint64(0), m.failed.Load())
+	p := <-q.ch
+	assert.Equal(t, "http/tasmota", p.Topic)
+	x, err := topicMap[p.Topic].parsePayload(p.Payload)
+	assert.NoError(t, err)
+	event := topicMap[p.Topic].ParseMessage(x)
+	assert.Equal(t, float64(0), event["power"])
+	assert.Equal(t, float64(150), event["out"])
+	assert.Equal(t, 10.5, event["total_in"])
+
+	status = http.StatusInternalServerError
+	pollMeter(m, q)
+	assert.Equal(t, uint64(1), m.failed.Load())
+	assert.True(t, m.failing.Load())
+	assert.Len(t, q.ch, 0)
+
+	m.Password = "wrong"
+	status = http.StatusOK
+	pollMeter(m, q)
+	assert.Equal(t, uint64(2), m.failed.Load())
+	m.Password = "secret"
+	pollMeter(m, q)
+	assert.False(t, m.failing.Load())
+	assert.Len(t, q.ch, 1)
+}
@@ -0,0 +1,242 @@
+/*
+* Copyright 2025-2026 Thorsten A. Knieling
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*    http://www.apache.org/licenses/LICENSE-2.0
+*
+ */
+
+package ecoflow2db
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/tknie/log"
+)
+
+const (
+	modbusReadHolding = 3
+	modbusReadInput   = 4
+)
+
+// modbusMeter meter source reading registers of a Modbus TCP device like
+// the SDM630 behind a Modbus TCP gateway. The register values are passed
+// as JSON object to the topic mapping. If no mapping is defined, each
+// register is mapped to its destination as float64
+type modbusMeter struct {
+	Address   string            `yaml:"address"`
+	UnitID    byte              `yaml:"unitId"`
+	Registers []*modbusRegister `yaml:"registers"`
+	meterPoll `yaml:",inline"`
+	Topic     `yaml:",inline"`
+	lock      sync.Mutex
+	conn      net.Conn
+	tid       uint16
+}
+
+// modbusRegister register definition. Function is 'holding' (default)
+// or 'input', Type one of uint16, int16, uint32, int32, uint64, int64,
+// float32 or float64. ByteOrder is given for four bytes: ABCD is big
+// endian (default), CDAB word swapped, BADC byte swapped and DCBA
+// little endian
+type modbusRegister struct {
+	Destination string  `yaml:"destination"`
+	Address     uint16  `yaml:"address"`
+	Function    string  `yaml:"function"`
+	Type        string  `yaml:"type"`
+	Scale       float64 `yaml:"scale"`
+	ByteOrder   string  `yaml:"byteOrder"`
+	IfNegative  string  `yaml:"ifNegative,omitempty"`
+}
+
+// topic topic of the meter, the default mapping is created from the
+// register definitions
+func (m *modbusMeter) topic() *Topic {
+	if len(m.Mapping) == 0 {
+		for _, r := range m.Registers {
+			m.Mapping = append(m.Mapping, MappingEntry{Source: r.Destination,
+				Destination: r.Destination, Type: "float64", IfNegative: r.IfNegative})
+		}
+	}
+	return &m.Topic
+}
+
+func (m *modbusMeter) source() string {
+	return m.Address
+}
+
+// read read all registers and return them as JSON object
+func (m *modbusMeter) read() ([]byte, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	values := make(map[string]float64)
+	for _, r := range m.Registers {
+		v, err := m.readRegister(r)
+		if err != nil {
+			if m.conn != nil {
+				m.conn.Close()
+				m.conn = nil
+			}
+			return nil, fmt.Errorf("register %s (%d): %v", r.Destination, r.Address, err)
+		}
+		values[r.Destination] = v
+	}
+	return json.Marshal(values)
+}
+
+// readRegister read the register value and scale it
+func (m *modbusMeter) readRegister(r *modbusRegister) (float64, error) {
+	fc := byte(modbusReadHolding)
+	switch r.Function {
+	case "", "holding":
+	case "input":
+		fc = modbusReadInput
+	default:
+		return 0, fmt.Errorf("unknown register function %s", r.Function)
+	}
+	size, err := r.words()
+	if err != nil {
+		return 0, err
+	}
+	data, err := m.request(fc, r.Address, size)
+	if err != nil {
+		return 0, err
+	}
+	v, err := r.decode(data)
+	if err != nil {
+		return 0, err
+	}
+	if r.Scale != 0 {
+		v *= r.Scale
+	}
+	return v, nil
+}
+
+// request send read request of quantity registers and return the
+// register data
+func (m *modbusMeter) request(fc byte, address, quantity uint16) ([]byte, error) {
+	if m.conn == nil {
+		conn, err := net.DialTimeout("tcp", m.Address, m.timeout())
+		if err != nil {
+			return nil, err
+		}
+		m.conn = conn
+	}
+	err := m.conn.SetDeadline(time.Now().Add(m.timeout()))
+	if err != nil {
+		return nil, err
+	}
+	m.tid++
+	req := make([]byte, 12)
+	binary.BigEndian.PutUint16(req[0:], m.tid)
+	binary.BigEndian.PutUint16(req[2:], 0)
+	binary.BigEndian.PutUint16(req[4:], 6)
+	req[6] = m.UnitID
+	req[7] = fc
+	binary.BigEndian.PutUint16(req[8:], address)
+	binary.BigEndian.PutUint16(req[10:], quantity)
+	log.Log.Debugf("Modbus request %s", FormatByteBuffer("Request", req))
+	if _, err = m.conn.Write(req); err != nil {
+		return nil, err
+	}
+	header := make([]byte, 7)
+	if _, err = io.ReadFull(m.conn, header); err != nil {
+		return nil, err
+	}
+	length := binary.BigEndian.Uint16(header[4:])
+	if length < 3 || length > 256 {
+		return nil, fmt.Errorf("invalid response length %d", length)
+	}
+	pdu := make([]byte, length-1)
+	if _, err = io.ReadFull(m.conn, pdu); err != nil {
+		return nil, err
+	}
+	if tid := binary.BigEndian.Uint16(header[0:]); tid != m.tid {
+		return nil, fmt.Errorf("transaction id mismatch %d != %d", tid, m.tid)
+	}
+	switch {
+	case pdu[0] == fc|0x80:
+		return nil, fmt.Errorf("modbus exception code %d", pdu[1])
+	case pdu[0] != fc:
+		return nil, fmt.Errorf("unexpected function code %d", pdu[0])
+	case len(pdu) < 2 || int(pdu[1]) != len(pdu)-2 || int(pdu[1]) != int(quantity)*2:
+		return nil, fmt.Errorf("invalid byte count in response")
+	}
+	return pdu[2:], nil
+}
+
+// words number of 16-bit registers of the register type
+func (r *modbusRegister) words() (uint16, error) {
+	switch r.Type {
+	case "uint16", "int16":
+		return 1, nil
+	case "", "uint32", "int32", "float32":
+		return 2, nil
+	case "uint64", "int64", "float64":
+		return 4, nil
+	default:
+		return 0, fmt.Errorf("unknown register type %s", r.Type)
+	}
+}
+
+// decode reorder the register data into big endian and convert it into
+// the register type. The default type is float32
+func (r *modbusRegister) decode(data []byte) (float64, error) {
+	b := make([]byte, len(data))
+	copy(b, data)
+	switch r.ByteOrder {
+	case "", "ABCD":
+	case "CDAB":
+		swapWords(b)
+	case "BADC":
+		swapBytes(b)
+	case "DCBA":
+		swapWords(b)
+		swapBytes(b)
+	default:
+		return 0, fmt.Errorf("unknown byte order %s", r.ByteOrder)
+	}
+	switch r.Type {
+	case "uint16":
+		return float64(binary.BigEndian.Uint16(b)), nil
+	case "int16":
+		return float64(int16(binary.BigEndian.Uint16(b))), nil
+	case "uint32":
+		return float64(binary.BigEndian.Uint32(b)), nil
+	case "int32":
+		return float64(int32(binary.BigEndian.Uint32(b))), nil
+	case "", "float32":
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), nil
+	case "uint64":
+		return float64(binary.BigEndian.Uint64(b)), nil
+	case "int64":
+		return float64(int64(binary.BigEndian.Uint64(b))), nil
+	case "float64":
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), nil
+	}
+	return 0, fmt.Errorf("unknown register type %s", r.Type)
+}
+
+// swapWords reverse the order of the 16-bit words
+func swapWords(b []byte) {
+	for i, j := 0, len(b)-2; i < j; i, j = i+2, j-2 {
+		b[i], b[i+1], b[j], b[j+1] = b[j], b[j+1], b[i], b[i+1]
+	}
+}
+
+// swapBytes swap the bytes inside each 16-bit word
+func swapBytes(b []byte) {
+	for i := 0; i+1 < len(b); i += 2 {
+		b[i], b[i+1] = b[i+1], b[i]
+	}
+}
@@ -0,0 +1,156 @@
+/*
+* Copyright 2025-2026 Thorsten A. Knieling
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*    http://www.apache.org/licenses/LICENSE-2.0
+*
+ */
+
+package ecoflow2db
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/assert/yaml"
+)
+
+// startModbusServer in-process Modbus TCP server answering read requests
+// with the given register banks, unknown registers return exception 2
+func startModbusServer(t *testing.T, banks map[byte]map[uint16]uint16) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				for {
+					req := make([]byte, 12)
+					if _, err := io.ReadFull(conn, req); err != nil {
+						return
+					}
+					fc := req[7]
+					address := binary.BigEndian.Uint16(req[8:])
+					quantity := binary.BigEndian.Uint16(req[10:])
+					pdu := []byte{fc, byte(quantity * 2)}
+					for i := uint16(0); i < quantity; i++ {
+						v, ok := banks[fc][address+i]
+						if !ok {
+							pdu = []byte{fc | 0x80, 2}
+							break
+						}
+						pdu = binary.BigEndian.AppendUint16(pdu, v)
+					}
+					resp := append([]byte{}, req[:4]...)
+					resp = binary.BigEndian.AppendUint16(resp, uint16(len(pdu)+1))
+					resp = append(resp, req[6])
+					resp = append(resp, pdu...)
+					if _, err := conn.Write(resp); err != nil {
+						return
+					}
+				}
+			}(conn)
+		}
+	}()
+	return l.Addr().String()
+}
+
+func TestModbusMeter(t *testing.T) {
+	power := math.Float32bits(-850.5)
+	address := startModbusServer(t, map[byte]map[uint16]uint16{
+		modbusReadInput: {0x34: uint16(power >> 16), 0x35: uint16(power)},
+		modbusReadHolding: {
+			0x10: 0x3412,          // int16 0x1234 little endian
+			0x20: 0x0001, 0x21: 0, // uint32 1 word swapped
+		},
+	})
+
+	config := &adapterConfig{}
+	err := yaml.Unmarshal([]byte(`
+meters:
+  modbus:
+    - name: modbus/sdm630
+      address: `+address+`
+      unitId: 1
+      intervalMs: 500
+      registers:
+        - destination: power
+          address: 0x34
+          function: input
+          type: float32
+          ifNegative: out
+        - destination: voltage
+          address: 0x10
+          type: int16
+          byteOrder: DCBA
+          scale: 0.1
+        - destination: counter
+          address: 0x20
+          type: uint32
+          byteOrder: CDAB
+`), config)
+	assert.NoError(t, err)
+	if !assert.Len(t, config.Meters.Modbus, 1) {
+		return
+	}
+	m := config.Meters.Modbus[0]
+	assert.Equal(t, 500, m.IntervalMs)
+	topicMap := config.topicMap()
+	topic := topicMap["modbus/sdm630"]
+	if !assert.NotNil(t, topic) {
+		return
+	}
+	assert.Len(t, topic.Mapping, 3)
+
+	q := newIngestQueue(5)
+	pollMeter(m, q)
+	assert.Equal(t, uint64(0), m.failed.Load())
+	if !assert.Len(t, q.ch, 1) {
+		return
+	}
+	p := <-q.ch
+	assert.Equal(t, "modbus/sdm630", p.Topic)
+	x, err := topic.parsePayload(p.Payload)
+	assert.NoError(t, err)
+	event := topic.ParseMessage(x)
+	assert.Equal(t, float64(0), event["power"])
+	assert.Equal(t, 850.5, event["out"])
+	assert.InDelta(t, 466.0, event["voltage"], 0.001)
+	assert.Equal(t, float64(1), event["counter"])
+
+	m.Registers = append(m.Registers, &modbusRegister{Destination: "missing", Address: 0x99, Type: "uint16"})
+	pollMeter(m, q)
+	assert.Equal(t, uint64(1), m.failed.Load())
+	assert.Len(t, q.ch, 0)
+}
+
+func TestModbusDecode(t *testing.T) {
+	data := []byte{0x01, 0x02, 0x03, 0x04}
+	for order, expected := range map[string]float64{"ABCD": 0x01020304,
+		"CDAB": 0x03040102, "BADC": 0x02010403, "DCBA": 0x04030201} {
+		r := &modbusRegister{Type: "uint32", ByteOrder: order}
+		v, err := r.decode(data)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, v, order)
+	}
+	r := &modbusRegister{Type: "int64", ByteOrder: "CDAB"}
+	v, err := r.decode([]byte{0xff, 0xfe, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff})
+	assert.NoError(t, err)
+	assert.Equal(t, float64(-2), v)
+	_, err = (&modbusRegister{Type: "uint32", ByteOrder: "XYZ"}).decode(data)
+	assert.Error(t, err)
+}
@@ -13,12 +13,10 @@ package ecoflow2db
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"net"
 	"os"
-	"os/signal"
-	"syscall"
+	"regexp"
 	"time"
 
 	"github.com/eclipse/paho.golang/paho"
@@ -40,57 +38,108 @@ var CloseIfStuck = false
 var blockRequestTime time.Time = time.Now().Add(time.Duration(10) * time.Second)
 var currentRequested float64 = 0
 
-type Mapping []struct {
+// MappingEntry maps one source field of the payload to a destination field.
+// Layout and Timezone are used by the time conversion types, Default is used
+// if the source value cannot be converted (otherwise the field is skipped)
+type MappingEntry struct {
 	Source      string `yaml:"source"`
 	Destination string `yaml:"destination"`
 	Type        string `yaml:"type"`
 	IfNegative  string `yaml:"ifNegative,omitempty"`
+	Layout      string `yaml:"layout,omitempty"`
+	Timezone    string `yaml:"timezone,omitempty"`
+	Default     string `yaml:"default,omitempty"`
 }
 
+type Mapping []MappingEntry
+
 type Topic struct {
-	Name    string  `yaml:"name"`
-	Mapping Mapping `yaml:"mapping"`
+	Name              string   `yaml:"name"`
+	Share             string   `yaml:"share"`
+	Qos               *int     `yaml:"qos"`
+	NoLocal           bool     `yaml:"noLocal"`
+	RetainHandling    int      `yaml:"retainHandling"`
+	RetainAsPublished bool     `yaml:"retainAsPublished"`
+	Preset            string   `yaml:"preset"`
+	QueuePolicy       string   `yaml:"queuePolicy"`
+	Format            string   `yaml:"format"`
+	Root              string   `yaml:"root"`
+	Fields            []string `yaml:"fields"`
+	Separator         string   `yaml:"separator"`
+	Pattern           string   `yaml:"pattern"`
+	Mapping           Mapping  `yaml:"mapping"`
+	TimeField         string   `yaml:"timeField"`
+	MaxAgeSeconds     int      `yaml:"maxAgeSeconds"`
+	MaxFutureSeconds  int      `yaml:"maxFutureSeconds"`
+	regex             *regexp.Regexp
+	lastEvent         time.Time
 }
 
 // loop loop through receiving all messages from MQTT and store them into
 // the database
-func loopIncomingMessages(msgChan chan *paho.Publish, topicMap map[string]*Topic) {
-	if OutLoopSeconds == 0 {
+func loopIncomingMessages(q *ingestQueue, topicMap map[string]*Topic) {
+	go loopCounterAndCancelOutput(q.ch, q.control, topicMap)
+}
+
+// handleMessage parse and process one received message
+func handleMessage(m *paho.Publish, topicMap map[string]*Topic) {
+	mqttCounter++
+	received := receivedTime(m)
+	recordMessage(m, received)
+	log.Log.Debugf("%s: Message: %s", m.Topic, string(m.Payload))
+	if setPointSubscription != "" && m.Topic == setPointSubscription {
+		setPointCommand(powerTarget(), m.Payload)
 		return
 	}
-	go loopCounterAndCancelOutput(msgChan, topicMap)
+	if topic, ok := topicMap[m.Topic]; ok {
+		log.Log.Debugf("EVENT....%s", string(m.Payload))
+		x, err := topic.parsePayload(m.Payload)
+		if err != nil {
+			storeDeadLetter(m.Topic, m.Payload, err)
+			return
+		}
+
+		em := topic.ParseMessage(x)
+		if em != nil && topic.checkEventTime(em, received) {
+			topic.processEvent(em)
+			os.Stdout.Sync()
+		}
+	}
 }
 
-func loopCounterAndCancelOutput(msgChan chan *paho.Publish, topicMap map[string]*Topic) {
+// loopCounterAndCancelOutput process the messages, messages of the control
+// channel are processed first. If OutLoopSeconds is 0, the messages are
+// processed without the periodic output and stuck check
+func loopCounterAndCancelOutput(msgChan, controlChan chan *paho.Publish, topicMap map[string]*Topic) {
 	lastCounter := uint64(0)
 	lastTime := time.Now()
 	try := 0
-	services.ServerMessage("Start MQTT analyze loop with output every %d seconds", OutLoopSeconds)
+	if OutLoopSeconds == 0 {
+		services.ServerMessage("Start MQTT analyze loop without output")
+	} else {
+		services.ServerMessage("Start MQTT analyze loop with output every %d seconds", OutLoopSeconds)
+	}
 	for {
+		// a nil channel never fires, the output is disabled
+		var outTimer <-chan time.Time
+		if OutLoopSeconds != 0 {
+			outTimer = time.After(time.Second * time.Duration(OutLoopSeconds))
+		}
 		select {
+		case m := <-controlChan:
+			handleMessage(m, topicMap)
+			continue
+		default:
+		}
+		select {
+		case m := <-controlChan:
+			handleMessage(m, topicMap)
 		case m := <-msgChan:
-			mqttCounter++
-			log.Log.Debugf("%s: Message: %s", m.Topic, string(m.Payload))
-			if topic, ok := topicMap[m.Topic]; ok {
-				x := make(map[string]interface{})
-				log.Log.Debugf("EVENT....%s", string(m.Payload))
-				err := json.Unmarshal(m.Payload, &x)
-				if err != nil {
-					fmt.Println("JSON unmarshal fails:", err)
-					fmt.Println("JSON unmarshal fails for payload:", string(m.Payload))
-					continue
-				}
-
-				em := topic.ParseMessage(x)
-				if em != nil {
-					topic.processEvent(em)
-					os.Stdout.Sync()
-				}
-			}
+			handleMessage(m, topicMap)
 		case <-mqttDone:
 			services.ServerMessage("Ecoflow analyze loop is stopped")
 			return
-		case <-time.After(time.Second * time.Duration(OutLoopSeconds)):
+		case <-outTimer:
 			if mqttCounter == lastCounter && CloseIfStuck {
 				if try > 10 {
 					services.ServerMessage("Received MQTT msgs error still stuck")
@@ -102,7 +151,7 @@ func loopCounterAndCancelOutput(msgChan chan *paho.Publish, topicMap map[string]
 			}
 			lastCounter = mqttCounter
 		}
-		if lastTime.Add(60 * time.Second).Before(time.Now()) {
+		if OutLoopSeconds != 0 && lastTime.Add(60*time.Second).Before(time.Now()) {
 			p := message.NewPrinter(message.MatchLanguage("en"))
 			services.ServerMessage(p.Sprintf("Received realtime MQTT msgs: %4d", mqttCounter))
 			lastTime = time.Now()
@@ -111,6 +160,15 @@ func loopCounterAndCancelOutput(msgChan chan *paho.Publish, topicMap map[string]
 }
 
 func getMqttCurrentRequest() {
+	if DryRun {
+		return
+	}
+	if !powerReadBack() {
+		if currentRequested == 0 {
+			currentRequested = float64(adapter.DefaultConfig.BaseRequest)
+		}
+		return
+	}
 	accessKey := os.ExpandEnv(adapter.EcoflowConfig.AccessKey)
 	secretKey := os.ExpandEnv(adapter.EcoflowConfig.SecretKey)
 	if accessKey == "" {
@@ -133,6 +191,7 @@ func getMqttCurrentRequest() {
 	if converterRequested != currentRequested {
 		services.ServerMessage("Update accu energy requested: %.1f before was %.1f", converterRequested, currentRequested)
 		currentRequested = converterRequested
+		publishRequested(converter, currentRequested)
 	}
 }
 
@@ -166,7 +225,10 @@ func (config *adapterConfig) ConnectMQTT() {
 		config.Mqtt.MaxTries = DefaultMaxTries
 	}
 	logger := &MQTTWrapperLogger{}
-	msgChan := make(chan *paho.Publish)
+	config.Mqtt.Record.startRecorder()
+	mqttQueue = newIngestQueue(config.Mqtt.QueueSize)
+
+	topicMap := config.topicMap()
 
 	if config.Mqtt.LoopIntervalSeconds > 0 {
 		OutLoopSeconds = config.Mqtt.LoopIntervalSeconds
@@ -175,11 +237,12 @@ func (config *adapterConfig) ConnectMQTT() {
 	services.ServerMessage("Connect TCP/IP to %s", config.Mqtt.Server)
 	conn := tryConnectMQTT(config.Mqtt.Server, config.Mqtt.MaxTries)
 
+	router := paho.NewStandardRouterWithDefault(func(m *paho.Publish) {
+		mqttQueue.push(m, topicMap[m.Topic].queuePolicy())
+	})
 	pahoClient := paho.NewClient(paho.ClientConfig{PacketTimeout: 2 * time.Minute,
-		Router: paho.NewStandardRouterWithDefault(func(m *paho.Publish) {
-			msgChan <- m
-		}),
-		Conn: conn,
+		Router: router,
+		Conn:   conn,
 		OnServerDisconnect: func(d *paho.Disconnect) {
 			services.ServerMessage("MQTT disconnected: %d - %s", d.ReasonCode, d.Properties.ReasonString)
 
@@ -200,6 +263,8 @@ func (config *adapterConfig) ConnectMQTT() {
 		CleanStart: true,
 		Username:   config.Mqtt.Username,
 		Password:   []byte(password),
+		// set offline status if connection is lost
+		WillMessage: willMessage(),
 	}
 
 	if config.Mqtt.Username != "" {
@@ -224,28 +289,18 @@ func (config *adapterConfig) ConnectMQTT() {
 	}
 
 	services.ServerMessage("Connecting MQTT to %s", config.Mqtt.Server)
+	mqttClient = pahoClient
+	publishStatus(publishOnline)
 
-	ic := make(chan os.Signal, 1)
-	signal.Notify(ic, os.Interrupt, syscall.SIGTERM)
-	go func() {
-		<-ic
-		fmt.Println("signal received, exiting")
-		if config != nil {
-			d := &paho.Disconnect{ReasonCode: 0}
-			pahoClient.Disconnect(d)
-		}
-		os.Exit(0)
-	}()
-
-	topicMap := make(map[string]*Topic)
 	// subscribe to a subscription MQTT topic
 	subscriptions := make([]paho.SubscribeOptions, 0)
 	for _, topic := range config.Mqtt.Topics {
-		topicMap[topic.Name] = topic
-		subscriptions = append(subscriptions, paho.SubscribeOptions{Topic: topic.Name,
-			QoS: byte(config.Mqtt.Qos)})
-
-		services.ServerMessage("Subscribed MQTT to %s", topic.Name)
+		so := topic.subscribeOptions(config.Mqtt.Qos)
+		subscriptions = append(subscriptions, so)
+		services.ServerMessage("Subscribe MQTT to %s with QoS %d", so.Topic, so.QoS)
+	}
+	if so := registerSetPointHandler(router); so != nil {
+		subscriptions = append(subscriptions, *so)
 	}
 	sa, err := pahoClient.Subscribe(context.Background(), &paho.Subscribe{
 		Subscriptions: subscriptions,
@@ -254,19 +309,44 @@ func (config *adapterConfig) ConnectMQTT() {
 		services.ServerMessage("Error subscribing MQTT ... %v", err)
 		log.Log.Fatalf("Error subscribing MQTT: %v", err)
 	}
-	if sa.Reasons[0] != byte(config.Mqtt.Qos) {
-		log.Log.Fatalf("Failed to subscribe to %v : %d", subscriptions, sa.Reasons[0])
+	warnings, err := checkSuback(subscriptions, sa)
+	for _, w := range warnings {
+		services.ServerMessage("Attention: %s", w)
+	}
+	if err != nil {
+		services.ServerMessage("Error subscribing MQTT ... %v", err)
+		log.Log.Fatalf("Failed to subscribe MQTT: %v", err)
+	}
+	go loopIncomingMessages(mqttQueue, topicMap)
+}
+
+// disconnectMQTT publish the offline state and disconnect the MQTT client,
+// called by the graceful shutdown after the database is flushed
+func disconnectMQTT() {
+	if mqttClient == nil {
+		return
+	}
+	publishStatus(publishOffline)
+	err := mqttClient.Disconnect(&paho.Disconnect{ReasonCode: 0})
+	if err != nil {
+		log.Log.Errorf("Error disconnecting MQTT: %v", err)
 	}
-	go loopIncomingMessages(msgChan, topicMap)
 }
 
 func (topic *Topic) processEvent(event map[string]interface{}) {
 	log.Log.Debugf("Processing event for topic: %s, got event: %v request: %f",
 		topic.Name, event, currentRequested)
 	newRequested := currentRequested
-	converter := os.ExpandEnv(adapter.EcoflowConfig.MicroConverter[0])
-	out := event["out"].(float64)
-	power := event["power"].(float64)
+	converter := powerTarget()
+	if converter == "" {
+		log.Log.Errorf("No micro converter defined, event of topic %s ignored", topic.Name)
+		return
+	}
+	power, out, ok := eventBalance(event)
+	if !ok {
+		log.Log.Errorf("Event of topic %s misses power value: %v", topic.Name, event)
+		return
+	}
 	log.Log.Debugf("Pre-Power: %f, out: %f, new requested: %f, current requested: %f, blockRequestTime: %v",
 		power, out, newRequested, currentRequested, time.Until(blockRequestTime))
 
@@ -274,6 +354,11 @@ func (topic *Topic) processEvent(event map[string]interface{}) {
 		getMqttCurrentRequest()
 		return
 	}
+	if setPointActive() {
+		log.Log.Debugf("Home Assistant set-point %0.1f active until %v, realtime request skipped",
+			setPointOverride, setPointUntil)
+		return
+	}
 	log.Log.Infof("Realtime request = %v  or new requested is same as last requested %f, computed value: %f power: %f out: %f",
 		adapter.DefaultConfig.RealtimeRequest, currentRequested, newRequested, power, out)
 
@@ -319,7 +404,14 @@ func (topic *Topic) processEvent(event map[string]interface{}) {
 		services.ServerMessage("Realtime power request:   %0.1f in [%04d:%04d] power = %0.1f out = %0.1f",
 			newRequested, adapter.DefaultConfig.BaseRequest, adapter.DefaultConfig.UpperBatLimit,
 			power, out)
-		client.SetEnvironmentPowerConsumption(converter, newRequested)
+		publishControl(converter, power, out, currentRequested, newRequested)
+		if DryRun {
+			currentRequested = newRequested
+			return
+		}
+		if setPowerRequest(converter, newRequested) != nil {
+			return
+		}
 		getMqttCurrentRequest()
 	}
 }
@@ -0,0 +1,173 @@
+/*
+* Copyright 2025-2026 Thorsten A. Knieling
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*    http://www.apache.org/licenses/LICENSE-2.0
+*
+ */
+
+package ecoflow2db
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// FormatJSON payload is a JSON object
+	FormatJSON = "json"
+	// FormatNumber payload is a bare number stored as 'value'
+	FormatNumber = "number"
+	// FormatCSV payload is one CSV line, names are given by fields
+	FormatCSV = "csv"
+	// FormatKV payload contains key=value lines
+	FormatKV = "kv"
+	// FormatRegex payload is parsed by regular expression with named groups
+	FormatRegex = "regex"
+)
+
+// numberKey key used for the value of number format payloads
+const numberKey = "value"
+
+// validateFormat check the payload format of the topic and compile the
+// regular expression once, the topic is shared by the receive loops
+func (topic *Topic) validateFormat() error {
+	switch topic.Format {
+	case "", FormatJSON, FormatNumber, FormatKV:
+	case FormatCSV:
+		if utf8.RuneCountInString(topic.Separator) > 1 {
+			return fmt.Errorf("separator '%s' of topic %s must be one character", topic.Separator, topic.Name)
+		}
+	case FormatRegex:
+		re, err := regexp.Compile(topic.Pattern)
+		if err != nil {
+			return fmt.Errorf("invalid pattern of topic %s: %v", topic.Name, err)
+		}
+		if slices.IndexFunc(re.SubexpNames(), func(n string) bool { return n != "" }) < 0 {
+			return fmt.Errorf("pattern of topic %s has no named group", topic.Name)
+		}
+		topic.regex = re
+	default:
+		return fmt.Errorf("unknown payload format '%s' of topic %s", topic.Format, topic.Name)
+	}
+	return nil
+}
+
+// parsePayload parse the payload corresponding to the topic format into
+// a map used by the topic mapping
+func (topic *Topic) parsePayload(payload []byte) (map[string]interface{}, error) {
+	switch topic.Format {
+	case "", FormatJSON:
+		x := make(map[string]interface{})
+		err := json.Unmarshal(payload, &x)
+		if err != nil {
+			return nil, err
+		}
+		if topic.Root != "" {
+			r, ok := resolveSource(topic.Root, x)
+			if !ok {
+				return nil, fmt.Errorf("root %s not found in payload", topic.Root)
+			}
+			if x, ok = r.(map[string]interface{}); !ok {
+				return nil, fmt.Errorf("root %s is not an object", topic.Root)
+			}
+		}
+		return x, nil
+	case FormatNumber:
+		f, err := strconv.ParseFloat(strings.TrimSpace(string(payload)), 64)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{numberKey: f}, nil
+	case FormatCSV:
+		return topic.parseCSV(payload)
+	case FormatKV:
+		return parseKeyValue(payload)
+	case FormatRegex:
+		return topic.parseRegex(payload)
+	default:
+		return nil, fmt.Errorf("unknown payload format %s", topic.Format)
+	}
+}
+
+// formatValue values are converted to float64 if numeric, otherwise
+// kept as string
+func formatValue(s string) interface{} {
+	s = strings.TrimSpace(s)
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return f
+	}
+	return s
+}
+
+// parseCSV parse one CSV line, names are taken from fields. If no
+// fields are defined, the position starting with 1 is used
+func (topic *Topic) parseCSV(payload []byte) (map[string]interface{}, error) {
+	r := csv.NewReader(strings.NewReader(strings.TrimSpace(string(payload))))
+	if topic.Separator != "" {
+		r.Comma = []rune(topic.Separator)[0]
+	}
+	r.FieldsPerRecord = -1
+	record, err := r.Read()
+	if err != nil {
+		return nil, err
+	}
+	x := make(map[string]interface{})
+	for i, v := range record {
+		name := strconv.Itoa(i + 1)
+		if i < len(topic.Fields) {
+			name = topic.Fields[i]
+		}
+		x[name] = formatValue(v)
+	}
+	return x, nil
+}
+
+// parseKeyValue parse key=value lines, lines without '=' are invalid
+func parseKeyValue(payload []byte) (map[string]interface{}, error) {
+	x := make(map[string]interface{})
+	for _, line := range strings.Split(string(payload), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		k, v, found := strings.Cut(line, "=")
+		if !found {
+			return nil, fmt.Errorf("invalid key=value line: %s", line)
+		}
+		x[strings.TrimSpace(k)] = formatValue(v)
+	}
+	if len(x) == 0 {
+		return nil, fmt.Errorf("no key=value entries found")
+	}
+	return x, nil
+}
+
+// parseRegex parse payload with the regular expression, all named groups
+// are used as names
+func (topic *Topic) parseRegex(payload []byte) (map[string]interface{}, error) {
+	if topic.regex == nil {
+		return nil, fmt.Errorf("pattern of topic %s is not compiled", topic.Name)
+	}
+	match := topic.regex.FindSubmatch(payload)
+	if match == nil {
+		return nil, fmt.Errorf("pattern does not match payload")
+	}
+	x := make(map[string]interface{})
+	for i, name := range topic.regex.SubexpNames() {
+		if i == 0 || name == "" {
+			continue
+		}
+		x[name] = formatValue(string(match[i]))
+	}
+	return x, nil
+}
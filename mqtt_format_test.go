@@ -0,0 +1,61 @@
+/*
+* Copyright 2025-2026 Thorsten A. Knieling
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*    http://www.apache.org/licenses/LICENSE-2.0
+*
+ */
+
+package ecoflow2db
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePayloadFormats(t *testing.T) {
+	topic := &Topic{Name: "meter/power", Format: FormatNumber,
+		Mapping: Mapping{{Source: "value", Destination: "power", Type: "float64", IfNegative: "out"}}}
+	x, err := topic.parsePayload([]byte(" 345.2\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"power": 345.2}, topic.ParseMessage(x))
+	_, err = topic.parsePayload([]byte("abc"))
+	assert.Error(t, err)
+
+	topic = &Topic{Name: "meter/csv", Format: FormatCSV, Separator: ";", Fields: []string{"time", "power"}}
+	x, err = topic.parsePayload([]byte("2024-03-01 10:11:12.000;-12.5;x"))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"time": "2024-03-01 10:11:12.000", "power": -12.5, "3": "x"}, x)
+
+	topic = &Topic{Name: "meter/kv", Format: FormatKV}
+	x, err = topic.parsePayload([]byte("power=345\nstate = on\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"power": float64(345), "state": "on"}, x)
+	_, err = topic.parsePayload([]byte("power"))
+	assert.Error(t, err)
+
+	topic = &Topic{Name: "meter/regex", Format: FormatRegex, Pattern: `P=(?P<power>-?[0-9.]+)W E=(?P<energy>[0-9.]+)`}
+	_, err = topic.parsePayload([]byte("P=-17.5W E=1234.5kWh"))
+	assert.Error(t, err)
+	assert.NoError(t, topic.validateFormat())
+	x, err = topic.parsePayload([]byte("P=-17.5W E=1234.5kWh"))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"power": -17.5, "energy": 1234.5}, x)
+	_, err = topic.parsePayload([]byte("xxx"))
+	assert.Error(t, err)
+
+	assert.Error(t, (&Topic{Name: "x", Format: FormatRegex, Pattern: "("}).validateFormat())
+	assert.Error(t, (&Topic{Name: "x", Format: FormatRegex, Pattern: "[0-9]+"}).validateFormat())
+	assert.Error(t, (&Topic{Name: "x", Format: FormatCSV, Separator: ";;"}).validateFormat())
+	assert.Error(t, (&Topic{Name: "x", Format: "xml"}).validateFormat())
+	assert.NoError(t, (&Topic{Name: "x", Format: FormatCSV, Separator: ";"}).validateFormat())
+
+	topic = &Topic{Name: "meter/json"}
+	x, err = topic.parsePayload([]byte(`{"ENERGY":{"Power":1}}`))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"ENERGY": map[string]interface{}{"Power": float64(1)}}, x)
+}
@@ -0,0 +1,258 @@
+/*
+* Copyright 2025-2026 Thorsten A. Knieling
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*    http://www.apache.org/licenses/LICENSE-2.0
+*
+ */
+
+package ecoflow2db
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/eclipse/paho.golang/paho"
+	"github.com/tknie/log"
+	"github.com/tknie/services"
+)
+
+const defaultDiscoveryPrefix = "homeassistant"
+const defaultSetPointHoldMinutes = 60
+
+type homeAssistantConfig struct {
+	DiscoveryPrefix     string                 `yaml:"discoveryPrefix"`
+	Sensors             []*homeAssistantSensor `yaml:"sensors"`
+	SetPointHoldMinutes int                    `yaml:"setPointHoldMinutes"`
+}
+
+// homeAssistantSensor quota key announced as Home Assistant sensor
+type homeAssistantSensor struct {
+	Key         string  `yaml:"key"`
+	Name        string  `yaml:"name"`
+	DeviceClass string  `yaml:"deviceClass"`
+	Unit        string  `yaml:"unit"`
+	StateClass  string  `yaml:"stateClass"`
+	Scale       float64 `yaml:"scale"`
+}
+
+// defaultSensors sensors used if no sensors are configured, only keys
+// provided by the device are announced
+var defaultSensors = []*homeAssistantSensor{
+	{Key: "20_1.pv1InputWatts", Name: "PV1 input", DeviceClass: "power", Unit: "W", StateClass: "measurement", Scale: 0.1},
+	{Key: "20_1.pv2InputWatts", Name: "PV2 input", DeviceClass: "power", Unit: "W", StateClass: "measurement", Scale: 0.1},
+	{Key: "20_1.batInputWatts", Name: "Battery input", DeviceClass: "power", Unit: "W", StateClass: "measurement", Scale: 0.1},
+	{Key: "20_1.invOutputWatts", Name: "Inverter output", DeviceClass: "power", Unit: "W", StateClass: "measurement", Scale: 0.1},
+	{Key: "20_1.batSoc", Name: "Battery SOC", DeviceClass: "battery", Unit: "%", StateClass: "measurement"},
+	{Key: "bms_bmsStatus.soc", Name: "Battery SOC", DeviceClass: "battery", Unit: "%", StateClass: "measurement"},
+	{Key: "bms_bmsStatus.temp", Name: "Battery temperature", DeviceClass: "temperature", Unit: "°C", StateClass: "measurement"},
+	{Key: "pd.wattsInSum", Name: "Input", DeviceClass: "power", Unit: "W", StateClass: "measurement"},
+	{Key: "pd.wattsOutSum", Name: "Output", DeviceClass: "power", Unit: "W", StateClass: "measurement"},
+}
+
+var objectIDRegexp = regexp.MustCompile(`[^a-z0-9]+`)
+var announced sync.Map
+
+type discoveryDevice struct {
+	Identifiers  []string `json:"identifiers"`
+	Name         string   `json:"name"`
+	Manufacturer string   `json:"manufacturer"`
+	Model        string   `json:"model,omitempty"`
+}
+
+type discoveryConfig struct {
+	Name              string           `json:"name"`
+	UniqueID          string           `json:"unique_id"`
+	ObjectID          string           `json:"object_id"`
+	StateTopic        string           `json:"state_topic"`
+	CommandTopic      string           `json:"command_topic,omitempty"`
+	AvailabilityTopic string           `json:"availability_topic"`
+	DeviceClass       string           `json:"device_class,omitempty"`
+	UnitOfMeasurement string           `json:"unit_of_measurement,omitempty"`
+	StateClass        string           `json:"state_class,omitempty"`
+	Min               *float64         `json:"min,omitempty"`
+	Max               *float64         `json:"max,omitempty"`
+	Step              *float64         `json:"step,omitempty"`
+	Mode              string           `json:"mode,omitempty"`
+	Device            *discoveryDevice `json:"device"`
+}
+
+// homeAssistantEnabled check if Home Assistant discovery is configured
+func homeAssistantEnabled() bool {
+	return publishEnabled() && adapter.Mqtt.Publish.HomeAssistant != nil
+}
+
+// sensors configured sensors or the default sensor list
+func (hac *homeAssistantConfig) sensors() []*homeAssistantSensor {
+	if len(hac.Sensors) > 0 {
+		return hac.Sensors
+	}
+	return defaultSensors
+}
+
+// discoveryTopic Home Assistant discovery configuration topic
+func (hac *homeAssistantConfig) discoveryTopic(component, sn, objectID string) string {
+	prefix := hac.DiscoveryPrefix
+	if prefix == "" {
+		prefix = defaultDiscoveryPrefix
+	}
+	return fmt.Sprintf("%s/%s/%s/%s/config", prefix, component, sn, objectID)
+}
+
+func objectID(key string) string {
+	return strings.Trim(objectIDRegexp.ReplaceAllString(strings.ToLower(key), "_"), "_")
+}
+
+func newDiscoveryDevice(sn string, data map[string]interface{}) *discoveryDevice {
+	d := &discoveryDevice{Identifiers: []string{sn}, Name: "Ecoflow " + sn, Manufacturer: "EcoFlow"}
+	if m, ok := data["pd.model"]; ok {
+		d.Model = fmt.Sprintf("%v", m)
+	}
+	return d
+}
+
+// announceHomeAssistant announce all sensors available in the quota data
+// of the device and the set-point of the inverter
+func announceHomeAssistant(sn string, data map[string]interface{}) {
+	if !homeAssistantEnabled() {
+		return
+	}
+	if _, loaded := announced.LoadOrStore(sn, true); loaded {
+		return
+	}
+	hac := adapter.Mqtt.Publish.HomeAssistant
+	device := newDiscoveryDevice(sn, data)
+	for _, s := range hac.sensors() {
+		if _, ok := data[s.Key]; !ok {
+			continue
+		}
+		id := objectID(s.Key)
+		dc := &discoveryConfig{Name: s.Name, UniqueID: sn + "_" + id, ObjectID: sn + "_" + id,
+			StateTopic: publishTopic(sn, id), AvailabilityTopic: publishTopic("status"),
+			DeviceClass: s.DeviceClass, UnitOfMeasurement: s.Unit, StateClass: s.StateClass,
+			Device: device}
+		publishDiscovery(hac.discoveryTopic("sensor", sn, id), dc)
+	}
+	if len(adapter.EcoflowConfig.MicroConverter) > 0 &&
+		os.ExpandEnv(adapter.EcoflowConfig.MicroConverter[0]) == sn {
+		minValue := float64(adapter.DefaultConfig.BaseRequest)
+		maxValue := float64(adapter.DefaultConfig.UpperBatLimit)
+		step := float64(1)
+		dc := &discoveryConfig{Name: "Set-point", UniqueID: sn + "_setpoint", ObjectID: sn + "_setpoint",
+			StateTopic: publishTopic(sn, "requested"), CommandTopic: setPointTopic(sn),
+			AvailabilityTopic: publishTopic("status"), DeviceClass: "power", UnitOfMeasurement: "W",
+			Min: &minValue, Max: &maxValue, Step: &step, Mode: "box", Device: device}
+		publishDiscovery(hac.discoveryTopic("number", sn, "setpoint"), dc)
+	}
+	services.ServerMessage("Home Assistant discovery announced for %s", sn)
+}
+
+func publishDiscovery(topic string, dc *discoveryConfig) {
+	b, err := json.Marshal(dc)
+	if err != nil {
+		log.Log.Errorf("Error marshal discovery config %s: %v", topic, err)
+		return
+	}
+	publish(topic, b)
+}
+
+// publishHomeAssistantState publish the state of all announced sensors
+func publishHomeAssistantState(sn string, data map[string]interface{}) {
+	if !homeAssistantEnabled() {
+		return
+	}
+	for _, s := range adapter.Mqtt.Publish.HomeAssistant.sensors() {
+		v, ok := eventFloat(data, s.Key)
+		if !ok {
+			continue
+		}
+		if s.Scale != 0 {
+			v *= s.Scale
+		}
+		publish(publishTopic(sn, objectID(s.Key)), []byte(strconv.FormatFloat(v, 'f', -1, 64)))
+	}
+}
+
+// setPointTopic command topic of the inverter set-point
+func setPointTopic(sn string) string {
+	return publishTopic(sn, "setpoint", "set")
+}
+
+// setPointSubscription subscribed set-point command topic, the commands
+// are handled by the analyze loop
+var setPointSubscription string
+
+// registerSetPointHandler register the handler receiving set-point commands
+// and return the corresponding subscription
+func registerSetPointHandler(router *paho.StandardRouter) *paho.SubscribeOptions {
+	if !homeAssistantEnabled() || len(adapter.EcoflowConfig.MicroConverter) == 0 {
+		return nil
+	}
+	converter := os.ExpandEnv(adapter.EcoflowConfig.MicroConverter[0])
+	topic := setPointTopic(converter)
+	setPointSubscription = topic
+	router.RegisterHandler(topic, func(m *paho.Publish) {
+		// the analyze loop owns the current request, the command is queued
+		// like a meter reading and never dropped
+		mqttQueue.push(m, QueueBlock)
+	})
+	services.ServerMessage("Subscribed MQTT set-point command to %s", topic)
+	return &paho.SubscribeOptions{Topic: topic, QoS: byte(adapter.Mqtt.Publish.Qos), NoLocal: true}
+}
+
+// setPointOverride set-point of Home Assistant the realtime request keeps
+// until setPointUntil. Both are only used by the analyze loop
+var setPointOverride float64
+var setPointUntil time.Time
+
+// setPointHold time the realtime request keeps a Home Assistant set-point
+func setPointHold() time.Duration {
+	if homeAssistantEnabled() && adapter.Mqtt.Publish.HomeAssistant.SetPointHoldMinutes > 0 {
+		return time.Duration(adapter.Mqtt.Publish.HomeAssistant.SetPointHoldMinutes) * time.Minute
+	}
+	return defaultSetPointHoldMinutes * time.Minute
+}
+
+// setPointActive check if a Home Assistant set-point overrides the
+// realtime request
+func setPointActive() bool {
+	return setPointOverride > 0 && time.Now().Before(setPointUntil)
+}
+
+// setPointCommand write the requested set-point through the actuator. The
+// set-point overrides the realtime request for the hold time, the payload
+// "auto" gives the control back to the realtime request
+func setPointCommand(converter string, payload []byte) {
+	if strings.EqualFold(strings.TrimSpace(string(payload)), "auto") {
+		setPointOverride = 0
+		services.ServerMessage("Home Assistant power request released")
+		return
+	}
+	value, err := strconv.ParseFloat(strings.TrimSpace(string(payload)), 64)
+	if err != nil {
+		log.Log.Errorf("Invalid set-point command %q: %v", string(payload), err)
+		return
+	}
+	if value < float64(adapter.DefaultConfig.BaseRequest) {
+		value = float64(adapter.DefaultConfig.BaseRequest)
+	}
+	if value > float64(adapter.DefaultConfig.UpperBatLimit) {
+		value = float64(adapter.DefaultConfig.UpperBatLimit)
+	}
+	services.ServerMessage("Home Assistant power request: %0.1f", value)
+	setPointOverride = value
+	setPointUntil = time.Now().Add(setPointHold())
+	if setPowerRequest(converter, value) != nil {
+		return
+	}
+	getMqttCurrentRequest()
+}
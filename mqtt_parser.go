@@ -12,8 +12,9 @@
 package ecoflow2db
 
 import (
-	"log"
-	"reflect"
+	"errors"
+	"fmt"
+	"math"
 	"strconv"
 	"strings"
 	"time"
@@ -22,25 +23,43 @@ import (
 	"github.com/tknie/services"
 )
 
+// ErrSourceMissing source field is not part of the payload
+var ErrSourceMissing = errors.New("source field missing")
+
+// ErrUnknownType mapping type is not supported
+var ErrUnknownType = errors.New("unknown mapping type")
+
+// ErrNotFinite numeric value is NaN or infinite
+var ErrNotFinite = errors.New("value is not a finite number")
+
+// ConversionError error converting a payload field into the mapping type
+type ConversionError struct {
+	Topic       string
+	Source      string
+	Destination string
+	Type        string
+	Value       interface{}
+	Err         error
+}
+
+func (ce *ConversionError) Error() string {
+	return fmt.Sprintf("topic %s: convert %s -> %s (%s) of value %v (%T): %v",
+		ce.Topic, ce.Source, ce.Destination, ce.Type, ce.Value, ce.Value, ce.Err)
+}
+
+func (ce *ConversionError) Unwrap() error {
+	return ce.Err
+}
+
 func (topic *Topic) createEntry(x map[string]interface{}) map[string]interface{} {
 	m := make(map[string]interface{})
 	tlog.Log.Debugf("Create mapping entry by %#v", x)
 	for _, e := range topic.Mapping {
 		tlog.Log.Debugf("From source %s", e.Source)
-		mNames := strings.Split(e.Source, "/")
-		var i interface{}
-		i = x
-		for _, s := range mNames {
-			tlog.Log.Debugf("Take %s", s)
-			if subMap, ok := i.(map[string]interface{})[s]; ok {
-				i = subMap
-			} else {
-				break
-			}
+		f, err := topic.convertField(&e, x)
+		if err != nil {
+			continue
 		}
-		tlog.Log.Debugf("Destination %s = %v (%s)", e.Destination, i, e.Type)
-		// t := reflect.TypeOf(e.Type)
-		f := reflectType(e.Type, i)
 		switch v := f.(type) {
 		case int64:
 			if e.IfNegative != "" && v < 0 {
@@ -77,65 +96,223 @@ func (topic *Topic) createEntry(x map[string]interface{}) map[string]interface{}
 	return m
 }
 
-func reflectType(fdType string, i interface{}) interface{} {
-	var t reflect.Type
-	switch fdType {
+// convertField resolve the source of the mapping entry and convert it. If the
+// conversion fails, the default value is used if defined. Otherwise the
+// error is returned and the field need to be skipped.
+func (topic *Topic) convertField(e *MappingEntry, x map[string]interface{}) (interface{}, error) {
+	i, found := resolveSource(e.Source, x)
+	var f interface{}
+	var err error
+	if !found {
+		err = ErrSourceMissing
+	} else {
+		tlog.Log.Debugf("Destination %s = %v (%s)", e.Destination, i, e.Type)
+		f, err = reflectType(e, i)
+	}
+	if err == nil {
+		return f, nil
+	}
+	ce := &ConversionError{Topic: topic.Name, Source: e.Source,
+		Destination: e.Destination, Type: e.Type, Value: i, Err: err}
+	stat := getMappingStatEntry(topic.Name)
+	if e.Default != "" {
+		f, err = reflectType(e, e.Default)
+		if err == nil {
+			stat.defaulted.Add(1)
+			tlog.Log.Debugf("Use default for %v", ce)
+			return f, nil
+		}
+		ce.Err = fmt.Errorf("%w (default %s: %v)", ce.Err, e.Default, err)
+	}
+	stat.skipped.Add(1)
+	tlog.Log.Errorf("Skip field: %v", ce)
+	return nil, ce
+}
+
+// resolveSource search the source path separated by '/' in the payload,
+// numeric path elements are used as index into arrays
+func resolveSource(source string, x map[string]interface{}) (interface{}, bool) {
+	var i interface{}
+	i = x
+	for _, s := range strings.Split(source, "/") {
+		tlog.Log.Debugf("Take %s", s)
+		switch sub := i.(type) {
+		case map[string]interface{}:
+			var ok bool
+			if i, ok = sub[s]; !ok {
+				return nil, false
+			}
+		case []interface{}:
+			index, err := strconv.Atoi(s)
+			if err != nil || index < 0 || index >= len(sub) {
+				return nil, false
+			}
+			i = sub[index]
+		default:
+			return nil, false
+		}
+	}
+	if i == nil {
+		return nil, false
+	}
+	return i, true
+}
+
+// reflectType convert the payload value into the mapping type
+func reflectType(e *MappingEntry, i interface{}) (interface{}, error) {
+	tlog.Log.Debugf("Resolve %s destType=%v %T", e.Type, i, i)
+	switch e.Type {
+	case "":
+		return i, nil
+	case "string":
+		if s, ok := i.(string); ok {
+			return s, nil
+		}
+		return fmt.Sprint(i), nil
 	case "int64":
-		t = reflect.TypeOf(int64(0))
+		f, err := toFloat64(i)
+		if err != nil {
+			return nil, err
+		}
+		if f >= math.MaxInt64 || f < math.MinInt64 {
+			return nil, fmt.Errorf("value out of int64 range")
+		}
+		return int64(f), nil
+	case "int32":
+		f, err := toFloat64(i)
+		if err != nil {
+			return nil, err
+		}
+		if f > math.MaxInt32 || f < math.MinInt32 {
+			return nil, fmt.Errorf("value out of int32 range")
+		}
+		return int32(f), nil
 	case "float64":
-		t = reflect.TypeOf(float64(0))
-	case "string":
-		t = reflect.TypeOf("")
+		return toFloat64(i)
+	case "bool":
+		return toBool(i)
 	case "time.Time":
-		t = reflect.TypeOf(time.Now())
+		s, ok := i.(string)
+		if !ok {
+			return nil, fmt.Errorf("time value need to be string")
+		}
+		loc, err := e.location()
+		if err != nil {
+			return nil, err
+		}
+		l := layout
+		if e.Layout != "" {
+			l = e.Layout
+		}
+		return time.ParseInLocation(l, s, loc)
+	case "rfc3339":
+		s, ok := i.(string)
+		if !ok {
+			return nil, fmt.Errorf("time value need to be string")
+		}
+		return time.Parse(time.RFC3339, s)
+	case "unix", "unixMilli":
+		f, err := toFloat64(i)
+		if err != nil {
+			return nil, err
+		}
+		loc, err := e.location()
+		if err != nil {
+			return nil, err
+		}
+		if e.Type == "unixMilli" {
+			return time.UnixMilli(int64(f)).In(loc), nil
+		}
+		sec, frac := math.Modf(f)
+		return time.Unix(int64(sec), int64(frac*1e9)).In(loc), nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownType, e.Type)
+	}
+}
 
+// location location used for time conversion, default is local time
+func (e *MappingEntry) location() (*time.Location, error) {
+	if e.Timezone == "" {
+		return time.Local, nil
 	}
-	o := reflect.New(t)
-	o = o.Elem()
-	tlog.Log.Debugf("Resolve %s destType=%v %T", fdType, i, i)
-	switch fdType {
-	case "time.Time":
-		tn, err := time.ParseInLocation(layout, i.(string), time.Local)
-		if err != nil {
-			log.Fatalf("Parse time location failed: %v", err)
-		}
-		v := reflect.ValueOf(tn)
-		o.Set(v)
-	// case "float64":
-	// 	i64 := i.(int64)
-	// 	fl64 := float64(i64)
-	// 	v := reflect.ValueOf(fl64)
-	// 	o.Set(v)
-	case "int64":
-		i64 := i.(float64)
-		fl64 := int64(i64)
-		v := reflect.ValueOf(fl64)
-		o.Set(v)
-	case "float64":
-		switch i.(type) {
-		case int64:
-			i64 := i.(int64)
-			fl64 := float64(i64)
-			v := reflect.ValueOf(fl64)
-			o.Set(v)
-		case float64:
-			i64 := i.(float64)
-			fl64 := float64(i64)
-			v := reflect.ValueOf(fl64)
-			o.Set(v)
-		case string:
-			if fl64, err := strconv.ParseFloat(i.(string), 64); err == nil {
-				v := reflect.ValueOf(fl64)
-				o.Set(v)
-			}
-		default:
-			log.Fatalf("Unknown type for float64 mapping: %T", i)
+	return time.LoadLocation(e.Timezone)
+}
+
+// toFloat64 convert numeric, boolean or string values to float64, NaN and
+// infinite values are rejected
+func toFloat64(i interface{}) (float64, error) {
+	f, err := toNumber(i)
+	if err != nil {
+		return 0, err
+	}
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, ErrNotFinite
+	}
+	return f, nil
+}
+
+// toNumber convert numeric, boolean or string values to float64
+func toNumber(i interface{}) (float64, error) {
+	switch v := i.(type) {
+	case float64:
+		return v, nil
+	case float32:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case int32:
+		return float64(v), nil
+	case int:
+		return float64(v), nil
+	case bool:
+		if v {
+			return 1, nil
 		}
+		return 0, nil
+	case string:
+		return strconv.ParseFloat(strings.TrimSpace(v), 64)
 	default:
-		v := reflect.ValueOf(i)
-		o.Set(v)
+		return 0, fmt.Errorf("unknown type for numeric mapping: %T", i)
+	}
+}
+
+// toBool convert boolean, numeric or string values to bool
+func toBool(i interface{}) (bool, error) {
+	switch v := i.(type) {
+	case bool:
+		return v, nil
+	case string:
+		switch strings.ToLower(strings.TrimSpace(v)) {
+		case "on", "yes":
+			return true, nil
+		case "off", "no":
+			return false, nil
+		}
+		return strconv.ParseBool(strings.TrimSpace(v))
+	default:
+		f, err := toFloat64(i)
+		if err != nil {
+			return false, err
+		}
+		return f != 0, nil
+	}
+}
+
+// eventFloat get numeric event value as float64
+func eventFloat(event map[string]interface{}, name string) (float64, bool) {
+	v, ok := event[name]
+	if !ok {
+		return 0, false
+	}
+	switch v.(type) {
+	case string, bool:
+		return 0, false
+	}
+	f, err := toFloat64(v)
+	if err != nil {
+		return 0, false
 	}
-	return o.Interface()
+	return f, true
 }
 
 func (topic *Topic) ParseMessage(x map[string]interface{}) map[string]interface{} {
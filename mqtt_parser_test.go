@@ -0,0 +1,86 @@
+/*
+* Copyright 2025-2026 Thorsten A. Knieling
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*    http://www.apache.org/licenses/LICENSE-2.0
+*
+ */
+
+package ecoflow2db
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReflectType(t *testing.T) {
+	v, err := reflectType(&MappingEntry{Type: "bool"}, "ON")
+	assert.NoError(t, err)
+	assert.Equal(t, true, v)
+	v, err = reflectType(&MappingEntry{Type: "int32"}, float64(123))
+	assert.NoError(t, err)
+	assert.Equal(t, int32(123), v)
+	v, err = reflectType(&MappingEntry{Type: "int64"}, "345")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(345), v)
+	v, err = reflectType(&MappingEntry{Type: "unix", Timezone: "UTC"}, float64(1700000000))
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2023, 11, 14, 22, 13, 20, 0, time.UTC), v)
+	v, err = reflectType(&MappingEntry{Type: "unixMilli", Timezone: "UTC"}, float64(1700000000123))
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2023, 11, 14, 22, 13, 20, 123000000, time.UTC), v)
+	v, err = reflectType(&MappingEntry{Type: "rfc3339"}, "2024-03-01T10:11:12Z")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 3, 1, 10, 11, 12, 0, time.UTC), v.(time.Time).UTC())
+	v, err = reflectType(&MappingEntry{Type: "time.Time", Layout: "2006-01-02T15:04:05",
+		Timezone: "Europe/Berlin"}, "2024-03-01T10:11:12")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 3, 1, 9, 11, 12, 0, time.UTC), v.(time.Time).UTC())
+
+	_, err = reflectType(&MappingEntry{Type: "time.Time"}, "xx")
+	assert.Error(t, err)
+	_, err = reflectType(&MappingEntry{Type: "float64"}, []interface{}{})
+	assert.Error(t, err)
+	_, err = reflectType(&MappingEntry{Type: "abc"}, 1.0)
+	assert.True(t, errors.Is(err, ErrUnknownType))
+
+	// 2^63 is the first float64 above the int64 range
+	_, err = reflectType(&MappingEntry{Type: "int64"}, float64(math.MaxInt64))
+	assert.Error(t, err)
+	v, err = reflectType(&MappingEntry{Type: "int64"}, float64(math.MinInt64))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(math.MinInt64), v)
+	for _, n := range []interface{}{math.NaN(), math.Inf(1), "-Inf", "NaN"} {
+		_, err = reflectType(&MappingEntry{Type: "float64"}, n)
+		assert.True(t, errors.Is(err, ErrNotFinite))
+	}
+	topic := &Topic{Name: "test/finite", Mapping: Mapping{{Source: "Power", Destination: "power", Type: "float64"}}}
+	_, err = topic.convertField(&topic.Mapping[0], map[string]interface{}{"Power": "+Inf"})
+	var ce *ConversionError
+	assert.True(t, errors.As(err, &ce))
+	assert.True(t, errors.Is(err, ErrNotFinite))
+}
+
+func TestCreateEntrySkipDefault(t *testing.T) {
+	topic := &Topic{Name: "test/skip", Mapping: Mapping{
+		{Source: "ENERGY/Power", Destination: "power", Type: "float64", IfNegative: "out"},
+		{Source: "ENERGY/Missing", Destination: "missing", Type: "float64"},
+		{Source: "ENERGY/Bad", Destination: "bad", Type: "float64", Default: "0"},
+		{Source: "Time", Destination: "time", Type: "time.Time"},
+	}}
+	m := topic.ParseMessage(map[string]interface{}{
+		"ENERGY": map[string]interface{}{"Power": -12.5, "Bad": "n/a"},
+		"Time":   "xxx",
+	})
+	assert.Equal(t, map[string]interface{}{"power": float64(0), "out": 12.5, "bad": float64(0)}, m)
+	stat := getMappingStatEntry("test/skip")
+	assert.Equal(t, uint64(2), stat.skipped.Load())
+	assert.Equal(t, uint64(1), stat.defaulted.Load())
+}
@@ -0,0 +1,101 @@
+/*
+* Copyright 2025-2026 Thorsten A. Knieling
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*    http://www.apache.org/licenses/LICENSE-2.0
+*
+ */
+
+package ecoflow2db
+
+import (
+	"fmt"
+	"sort"
+)
+
+// mappingPreset built-in mapping of common smart meters. All presets
+// provide the 'power' and 'out' fields used to calculate the power request
+type mappingPreset struct {
+	format  string
+	mapping Mapping
+}
+
+var mappingPresets = map[string]*mappingPreset{
+	// Tasmota SML reader, e.g. tele/<device>/SENSOR
+	"tasmota-sml": {format: FormatJSON, mapping: Mapping{
+		{Source: "Time", Destination: "time", Type: "time.Time", Layout: "2006-01-02T15:04:05"},
+		{Source: "SML/Power_curr", Destination: "power", Type: "float64", IfNegative: "out"},
+		{Source: "SML/Total_in", Destination: "total_in", Type: "float64"},
+		{Source: "SML/Total_out", Destination: "total_out", Type: "float64"},
+	}},
+	// Tasmota energy monitoring plug, e.g. tele/<device>/SENSOR
+	"tasmota-energy": {format: FormatJSON, mapping: Mapping{
+		{Source: "Time", Destination: "time", Type: "time.Time", Layout: "2006-01-02T15:04:05"},
+		{Source: "ENERGY/Power", Destination: "power", Type: "float64", IfNegative: "out"},
+		{Source: "ENERGY/Total", Destination: "total_in", Type: "float64"},
+	}},
+	// Shelly 3EM Gen1, shellies/<device>/status
+	"shelly-3em": {format: FormatJSON, mapping: Mapping{
+		{Source: "unixtime", Destination: "time", Type: "unix"},
+		{Source: "total_power", Destination: "power", Type: "float64", IfNegative: "out"},
+		{Source: "emeters/0/power", Destination: "power_l1", Type: "float64"},
+		{Source: "emeters/1/power", Destination: "power_l2", Type: "float64"},
+		{Source: "emeters/2/power", Destination: "power_l3", Type: "float64"},
+	}},
+	// Shelly Pro 3EM Gen2, <device>/status/em:0
+	"shelly-pro-3em": {format: FormatJSON, mapping: Mapping{
+		{Source: "total_act_power", Destination: "power", Type: "float64", IfNegative: "out"},
+		{Source: "a_act_power", Destination: "power_l1", Type: "float64"},
+		{Source: "b_act_power", Destination: "power_l2", Type: "float64"},
+		{Source: "c_act_power", Destination: "power_l3", Type: "float64"},
+	}},
+}
+
+// presetNames sorted list of all preset names
+func presetNames() []string {
+	names := make([]string, 0, len(mappingPresets))
+	for n := range mappingPresets {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// applyPreset merge the preset mapping into the topic mapping. Mapping
+// entries defined in the configuration replace preset entries with the
+// same destination, all other configured entries are appended
+func (topic *Topic) applyPreset() error {
+	if topic.Preset == "" {
+		return nil
+	}
+	preset, ok := mappingPresets[topic.Preset]
+	if !ok {
+		return fmt.Errorf("unknown preset %s of topic %s, known presets: %v",
+			topic.Preset, topic.Name, presetNames())
+	}
+	if topic.Format == "" {
+		topic.Format = preset.format
+	}
+	overrides := make(map[string]MappingEntry)
+	for _, e := range topic.Mapping {
+		overrides[e.Destination] = e
+	}
+	mapping := make(Mapping, 0, len(preset.mapping)+len(topic.Mapping))
+	for _, e := range preset.mapping {
+		if o, ok := overrides[e.Destination]; ok {
+			e = o
+			delete(overrides, o.Destination)
+		}
+		mapping = append(mapping, e)
+	}
+	for _, e := range topic.Mapping {
+		if _, ok := overrides[e.Destination]; ok {
+			mapping = append(mapping, e)
+		}
+	}
+	topic.Mapping = mapping
+	return nil
+}
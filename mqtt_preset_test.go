@@ -0,0 +1,71 @@
+/*
+* Copyright 2025-2026 Thorsten A. Knieling
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*    http://www.apache.org/licenses/LICENSE-2.0
+*
+ */
+
+package ecoflow2db
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPresetGolden(t *testing.T) {
+	local := time.Local
+	time.Local = time.UTC
+	defer func() { time.Local = local }()
+
+	for _, name := range presetNames() {
+		payload, err := os.ReadFile(filepath.Join("testdata", "presets", name+".json"))
+		if !assert.NoError(t, err, name) {
+			continue
+		}
+		golden, err := os.ReadFile(filepath.Join("testdata", "presets", name+".golden.json"))
+		if !assert.NoError(t, err, name) {
+			continue
+		}
+		topic := &Topic{Name: "meter/" + name, Preset: name}
+		assert.NoError(t, topic.applyPreset())
+		x, err := topic.parsePayload(payload)
+		assert.NoError(t, err, name)
+		result, err := json.Marshal(topic.ParseMessage(x))
+		assert.NoError(t, err, name)
+		assert.JSONEq(t, string(golden), string(result), name)
+		_, hasPower := eventFloat(topic.ParseMessage(x), "power")
+		assert.True(t, hasPower, name)
+	}
+}
+
+func TestPresetOverride(t *testing.T) {
+	topic := &Topic{Name: "meter/sml", Preset: "tasmota-sml", Mapping: Mapping{
+		{Source: "SML/Power_total", Destination: "power", Type: "float64", IfNegative: "out"},
+		{Source: "SML/Voltage", Destination: "voltage", Type: "float64"},
+	}}
+	assert.NoError(t, topic.applyPreset())
+	assert.Equal(t, FormatJSON, topic.Format)
+	assert.Len(t, topic.Mapping, 5)
+	assert.Equal(t, "SML/Power_total", topic.Mapping[1].Source)
+	assert.Equal(t, "voltage", topic.Mapping[4].Destination)
+	// applying twice must not change the mapping
+	assert.NoError(t, topic.applyPreset())
+	assert.Len(t, topic.Mapping, 5)
+
+	x, err := topic.parsePayload([]byte(`{"SML":{"Power_total":-20,"Voltage":230.5,"Total_in":1}}`))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"power": float64(0), "out": float64(20),
+		"voltage": 230.5, "total_in": float64(1)}, topic.ParseMessage(x))
+
+	topic = &Topic{Name: "meter/unknown", Preset: "xyz"}
+	assert.Error(t, topic.applyPreset())
+}
@@ -0,0 +1,207 @@
+/*
+* Copyright 2025-2026 Thorsten A. Knieling
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*    http://www.apache.org/licenses/LICENSE-2.0
+*
+ */
+
+package ecoflow2db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/eclipse/paho.golang/paho"
+	"github.com/tknie/log"
+)
+
+const defaultPublishPrefix = "ecoflow2db"
+
+const publishOnline = "online"
+const publishOffline = "offline"
+
+type publishConfig struct {
+	Prefix        string               `yaml:"prefix"`
+	Qos           int                  `yaml:"qos"`
+	HomeAssistant *homeAssistantConfig `yaml:"homeAssistant"`
+}
+
+// deviceState live state of one device published as retained JSON document
+type deviceState struct {
+	SerialNumber string    `json:"serial_number"`
+	Online       bool      `json:"online"`
+	Soc          *float64  `json:"soc,omitempty"`
+	PvWatts      *float64  `json:"pv_watts,omitempty"`
+	Requested    *float64  `json:"requested,omitempty"`
+	Control      *control  `json:"control,omitempty"`
+	Updated      time.Time `json:"updated"`
+}
+
+// control last control decision of the realtime request
+type control struct {
+	Power     float64   `json:"power"`
+	Out       float64   `json:"out"`
+	Previous  float64   `json:"previous"`
+	Requested float64   `json:"requested"`
+	Time      time.Time `json:"time"`
+}
+
+// socKeys quota keys containing the battery state of charge
+var socKeys = []string{"bms_bmsstatus.soc", "bms_bmsstatus.actsoc", "20_1.batsoc"}
+
+// pvKeys quota keys containing PV input in deci-watts
+var pvKeys = []string{"20_1.pv1inputwatts", "20_1.pv2inputwatts"}
+
+var mqttClient *paho.Client
+var deviceStates = make(map[string]*deviceState)
+var stateLock sync.Mutex
+
+// publishEnabled check if state publishing is configured
+func publishEnabled() bool {
+	return adapter.Mqtt != nil && adapter.Mqtt.Publish != nil
+}
+
+// publishTopic topic below the configured prefix
+func publishTopic(elements ...string) string {
+	prefix := adapter.Mqtt.Publish.Prefix
+	if prefix == "" {
+		prefix = defaultPublishPrefix
+	}
+	return strings.Join(append([]string{strings.TrimSuffix(prefix, "/")}, elements...), "/")
+}
+
+// willMessage last-will message set to offline if connection is lost
+func willMessage() *paho.WillMessage {
+	if !publishEnabled() {
+		return nil
+	}
+	return &paho.WillMessage{Retain: true, QoS: byte(adapter.Mqtt.Publish.Qos),
+		Topic: publishTopic("status"), Payload: []byte(publishOffline)}
+}
+
+// publish send retained payload to the topic on the meter MQTT connection
+func publish(topic string, payload []byte) {
+	if !publishEnabled() || mqttClient == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err := mqttClient.Publish(ctx, &paho.Publish{Topic: topic, Retain: true,
+		QoS: byte(adapter.Mqtt.Publish.Qos), Payload: payload})
+	if err != nil {
+		log.Log.Errorf("Error publishing MQTT topic %s: %v", topic, err)
+	}
+}
+
+// publishStatus publish online/offline availability
+func publishStatus(status string) {
+	publish(publishTopic("status"), []byte(status))
+}
+
+// getDeviceState get state entry of the device, stateLock need to be hold
+func getDeviceState(sn string) *deviceState {
+	if s, ok := deviceStates[sn]; ok {
+		return s
+	}
+	s := &deviceState{SerialNumber: sn}
+	deviceStates[sn] = s
+	return s
+}
+
+// publishDeviceState update the device state with the received quota data
+func publishDeviceState(sn string, data map[string]interface{}, online bool) {
+	if !publishEnabled() {
+		return
+	}
+	lower := make(map[string]interface{}, len(data))
+	for k, v := range data {
+		lower[strings.ToLower(k)] = v
+	}
+	stateLock.Lock()
+	s := getDeviceState(sn)
+	s.Online = online
+	for _, k := range socKeys {
+		if v, ok := eventFloat(lower, k); ok {
+			s.Soc = &v
+			break
+		}
+	}
+	pv := float64(0)
+	pvFound := false
+	for _, k := range pvKeys {
+		if v, ok := eventFloat(lower, k); ok {
+			pv += v / 10
+			pvFound = true
+		}
+	}
+	if pvFound {
+		s.PvWatts = &pv
+	}
+	s.Updated = time.Now()
+	stateLock.Unlock()
+	s.publish()
+}
+
+// publishRequested update the current request of the converter
+func publishRequested(sn string, requested float64) {
+	if !publishEnabled() {
+		return
+	}
+	stateLock.Lock()
+	s := getDeviceState(sn)
+	s.Requested = &requested
+	s.Updated = time.Now()
+	stateLock.Unlock()
+	s.publish()
+}
+
+// publishControl publish the control decision of the realtime request
+func publishControl(sn string, power, out, previous, requested float64) {
+	if !publishEnabled() {
+		return
+	}
+	stateLock.Lock()
+	s := getDeviceState(sn)
+	s.Control = &control{Power: power, Out: out, Previous: previous,
+		Requested: requested, Time: time.Now()}
+	s.Updated = time.Now()
+	stateLock.Unlock()
+	s.publish()
+}
+
+// publish publish the state document and the per-metric topics
+func (s *deviceState) publish() {
+	stateLock.Lock()
+	b, err := json.Marshal(s)
+	metrics := map[string]string{"online": fmt.Sprintf("%v", s.Online)}
+	if s.Soc != nil {
+		metrics["soc"] = fmt.Sprintf("%g", *s.Soc)
+	}
+	if s.PvWatts != nil {
+		metrics["pv_watts"] = fmt.Sprintf("%g", *s.PvWatts)
+	}
+	if s.Requested != nil {
+		metrics["requested"] = fmt.Sprintf("%g", *s.Requested)
+	}
+	if s.Control != nil {
+		metrics["control_requested"] = fmt.Sprintf("%g", s.Control.Requested)
+	}
+	sn := s.SerialNumber
+	stateLock.Unlock()
+	if err != nil {
+		log.Log.Errorf("Error marshal device state %s: %v", sn, err)
+		return
+	}
+	publish(publishTopic(sn, "state"), b)
+	for k, v := range metrics {
+		publish(publishTopic(sn, k), []byte(v))
+	}
+}
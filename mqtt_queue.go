@@ -0,0 +1,116 @@
+/*
+* Copyright 2025-2026 Thorsten A. Knieling
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*    http://www.apache.org/licenses/LICENSE-2.0
+*
+ */
+
+package ecoflow2db
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/eclipse/paho.golang/paho"
+	"github.com/tknie/log"
+)
+
+const DefaultQueueSize = 100
+
+const (
+	// QueueDropOldest drop oldest queued message if queue is full
+	QueueDropOldest = "dropOldest"
+	// QueueBlock block receiver until queue has space
+	QueueBlock = "block"
+)
+
+// ingestQueue bounded queue between the MQTT router and the analyze loop.
+// Messages of block policy topics are queued separately, so dropping the
+// oldest message never drops them
+type ingestQueue struct {
+	ch       chan *paho.Publish
+	control  chan *paho.Publish
+	enqueued atomic.Uint64
+	dropped  atomic.Uint64
+	blocked  atomic.Uint64
+	maxDepth atomic.Int64
+}
+
+var mqttQueue *ingestQueue
+
+func newIngestQueue(size int) *ingestQueue {
+	if size <= 0 {
+		size = DefaultQueueSize
+	}
+	return &ingestQueue{ch: make(chan *paho.Publish, size), control: make(chan *paho.Publish, size)}
+}
+
+// validateQueuePolicy check the queue policy of the topic
+func (topic *Topic) validateQueuePolicy() error {
+	switch topic.QueuePolicy {
+	case "", QueueDropOldest, QueueBlock:
+		return nil
+	}
+	return fmt.Errorf("unknown queue policy '%s' of topic %s, use %s or %s",
+		topic.QueuePolicy, topic.Name, QueueDropOldest, QueueBlock)
+}
+
+// queuePolicy policy of the topic, meter readings drop the oldest entry
+func (topic *Topic) queuePolicy() string {
+	if topic == nil || topic.QueuePolicy == "" {
+		return QueueDropOldest
+	}
+	return topic.QueuePolicy
+}
+
+// push add message into queue using the given policy
+func (q *ingestQueue) push(m *paho.Publish, policy string) {
+	switch policy {
+	case QueueBlock:
+		select {
+		case q.control <- m:
+		default:
+			q.blocked.Add(1)
+			q.control <- m
+		}
+	default:
+		for {
+			select {
+			case q.ch <- m:
+				q.updateDepth()
+				q.enqueued.Add(1)
+				return
+			default:
+			}
+			select {
+			case old := <-q.ch:
+				q.dropped.Add(1)
+				log.Log.Debugf("Queue full, drop message of %s", old.Topic)
+			default:
+			}
+		}
+	}
+	q.updateDepth()
+	q.enqueued.Add(1)
+}
+
+func (q *ingestQueue) updateDepth() {
+	depth := int64(len(q.ch) + len(q.control))
+	for {
+		max := q.maxDepth.Load()
+		if depth <= max || q.maxDepth.CompareAndSwap(max, depth) {
+			return
+		}
+	}
+}
+
+// String statistic output of the queue
+func (q *ingestQueue) String() string {
+	return fmt.Sprintf("queue depth %03d/%03d control %03d/%03d (max %03d) enqueued %03d dropped %03d blocked %03d ",
+		len(q.ch), cap(q.ch), len(q.control), cap(q.control), q.maxDepth.Load(), q.enqueued.Load(),
+		q.dropped.Load(), q.blocked.Load())
+}
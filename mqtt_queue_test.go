@@ -0,0 +1,125 @@
+/*
+* Copyright 2025-2026 Thorsten A. Knieling
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*    http://www.apache.org/licenses/LICENSE-2.0
+*
+ */
+
+package ecoflow2db
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/eclipse/paho.golang/paho"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIngestQueue(t *testing.T) {
+	q := newIngestQueue(2)
+	for i := 0; i < 5; i++ {
+		q.push(&paho.Publish{Topic: fmt.Sprintf("meter/%d", i)}, (*Topic)(nil).queuePolicy())
+	}
+	assert.Equal(t, uint64(3), q.dropped.Load())
+	assert.Equal(t, uint64(5), q.enqueued.Load())
+	assert.Equal(t, int64(2), q.maxDepth.Load())
+	assert.Equal(t, "meter/3", (<-q.ch).Topic)
+	assert.Equal(t, "meter/4", (<-q.ch).Topic)
+
+	q.push(&paho.Publish{Topic: "control/1"}, QueueBlock)
+	q.push(&paho.Publish{Topic: "control/2"}, QueueBlock)
+	done := make(chan bool)
+	go func() {
+		q.push(&paho.Publish{Topic: "control/3"}, QueueBlock)
+		done <- true
+	}()
+	assert.Equal(t, "control/1", (<-q.control).Topic)
+	<-done
+	assert.Equal(t, uint64(3), q.dropped.Load())
+	assert.Equal(t, "control/2", (<-q.control).Topic)
+	assert.Equal(t, "control/3", (<-q.control).Topic)
+
+	// full meter queue never drops block policy messages
+	q.push(&paho.Publish{Topic: "control/4"}, QueueBlock)
+	for i := 0; i < 5; i++ {
+		q.push(&paho.Publish{Topic: fmt.Sprintf("meter/%d", i)}, QueueDropOldest)
+	}
+	assert.Equal(t, uint64(6), q.dropped.Load())
+	assert.Equal(t, "control/4", (<-q.control).Topic)
+
+	assert.NoError(t, (&Topic{Name: "a", QueuePolicy: QueueBlock}).validateQueuePolicy())
+	assert.NoError(t, (&Topic{Name: "a"}).validateQueuePolicy())
+	assert.Error(t, (&Topic{Name: "a", QueuePolicy: "blocking"}).validateQueuePolicy())
+}
+
+func TestSetPointCommandQueued(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+	}))
+	defer server.Close()
+	a, err := (&actuatorConfig{Type: ActuatorHTTP, URL: server.URL}).newActuator()
+	assert.NoError(t, err)
+	setActuator(a)
+	defer setActuator(nil)
+	oldConfig, oldRequested, oldActuator := adapter.DefaultConfig, currentRequested, adapter.Actuator
+	defer func() {
+		adapter.DefaultConfig, currentRequested, setPointSubscription = oldConfig, oldRequested, ""
+		adapter.Actuator, setPointOverride = oldActuator, 0
+	}()
+	adapter.DefaultConfig = &defaultConfig{BaseRequest: 100, UpperBatLimit: 600, RealtimeRequest: true}
+	adapter.Actuator = &actuatorConfig{Type: ActuatorHTTP, URL: server.URL, Target: "HW51"}
+	setPointSubscription = "ecoflow2db/HW51/setpoint/set"
+
+	// set-point commands are handled by the analyze loop in order
+	q := newIngestQueue(2)
+	q.push(&paho.Publish{Topic: setPointSubscription, Payload: []byte("300")}, QueueBlock)
+	q.push(&paho.Publish{Topic: setPointSubscription, Payload: []byte("900")}, QueueBlock)
+	handleMessage(<-q.control, nil)
+	assert.Equal(t, 300.0, currentRequested)
+	handleMessage(<-q.control, nil)
+	assert.Equal(t, 600.0, currentRequested)
+	assert.Equal(t, 2, requests)
+
+	// the realtime request keeps the set-point until it is released
+	topic := &Topic{Name: "meter"}
+	topic.processEvent(map[string]interface{}{"power": 0.0, "out": 300.0})
+	assert.Equal(t, 600.0, currentRequested)
+	assert.Equal(t, 2, requests)
+	assert.True(t, setPointActive())
+	setPointCommand(powerTarget(), []byte("auto"))
+	assert.False(t, setPointActive())
+	topic.processEvent(map[string]interface{}{"power": 0.0, "out": 300.0})
+	assert.Equal(t, 300.0, currentRequested)
+	assert.Equal(t, 3, requests)
+
+	// the set-point expires after the hold time
+	setPointCommand(powerTarget(), []byte("500"))
+	setPointUntil = time.Now().Add(-time.Second)
+	assert.False(t, setPointActive())
+}
+
+func TestAnalyzeLoopWithoutOutput(t *testing.T) {
+	oldSeconds := OutLoopSeconds
+	defer func() { OutLoopSeconds = oldSeconds }()
+	OutLoopSeconds = 0
+
+	// the messages are consumed even if the periodic output is disabled
+	q := newIngestQueue(2)
+	start := mqttCounter
+	loopIncomingMessages(q, map[string]*Topic{})
+	q.push(&paho.Publish{Topic: "meter/1"}, QueueDropOldest)
+	q.push(&paho.Publish{Topic: "control/1"}, QueueBlock)
+	assert.Eventually(t, func() bool {
+		return len(q.ch) == 0 && len(q.control) == 0 && mqttCounter == start+2
+	}, time.Second, 10*time.Millisecond)
+	mqttDone <- true
+	assert.Eventually(t, func() bool { return len(mqttDone) == 0 }, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,108 @@
+/*
+* Copyright 2025-2026 Thorsten A. Knieling
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*    http://www.apache.org/licenses/LICENSE-2.0
+*
+ */
+
+package ecoflow2db
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/eclipse/paho.golang/paho"
+)
+
+// sharePrefix prefix of MQTT v5 shared subscriptions
+const sharePrefix = "$share/"
+
+// subackReasons MQTT v5 SUBACK failure reason codes
+var subackReasons = map[byte]string{
+	0x80: "unspecified error",
+	0x83: "implementation specific error",
+	0x87: "not authorized",
+	0x8F: "topic filter invalid",
+	0x91: "packet identifier in use",
+	0x97: "quota exceeded",
+	0x9E: "shared subscriptions not supported",
+	0xA1: "subscription identifiers not supported",
+	0xA2: "wildcard subscriptions not supported",
+}
+
+// messageTopic topic of the received messages. Shared subscriptions
+// receive the messages with the topic without the share group
+func (topic *Topic) messageTopic() string {
+	if !strings.HasPrefix(topic.Name, sharePrefix) {
+		return topic.Name
+	}
+	_, t, found := strings.Cut(strings.TrimPrefix(topic.Name, sharePrefix), "/")
+	if !found {
+		return topic.Name
+	}
+	return t
+}
+
+// subscribeTopic topic filter used for the subscription, the share group
+// is added if configured
+func (topic *Topic) subscribeTopic() string {
+	if topic.Share == "" || strings.HasPrefix(topic.Name, sharePrefix) {
+		return topic.Name
+	}
+	return sharePrefix + topic.Share + "/" + topic.Name
+}
+
+// subscribeOptions subscription options of the topic, the QoS of the
+// MQTT configuration is used if not set for the topic
+func (topic *Topic) subscribeOptions(qos int) paho.SubscribeOptions {
+	if topic.Qos != nil {
+		qos = *topic.Qos
+	}
+	return paho.SubscribeOptions{Topic: topic.subscribeTopic(), QoS: byte(qos),
+		NoLocal: topic.NoLocal, RetainHandling: byte(topic.RetainHandling),
+		RetainAsPublished: topic.RetainAsPublished}
+}
+
+// validateSubscription check the subscription options of the topic
+func (topic *Topic) validateSubscription() error {
+	if topic.Qos != nil && (*topic.Qos < 0 || *topic.Qos > 2) {
+		return fmt.Errorf("topic %s: invalid QoS %d", topic.Name, *topic.Qos)
+	}
+	if topic.RetainHandling < 0 || topic.RetainHandling > 2 {
+		return fmt.Errorf("topic %s: invalid retain handling %d", topic.Name, topic.RetainHandling)
+	}
+	if topic.NoLocal && strings.HasPrefix(topic.subscribeTopic(), sharePrefix) {
+		// MQTT v5 protocol error: no-local is not allowed on shared subscriptions
+		return fmt.Errorf("topic %s: no-local not allowed on shared subscription", topic.Name)
+	}
+	return nil
+}
+
+// checkSuback check the reason codes of all subscriptions. Granted QoS
+// lower than requested are returned as warnings
+func checkSuback(subscriptions []paho.SubscribeOptions, sa *paho.Suback) (warnings []string, err error) {
+	if len(sa.Reasons) != len(subscriptions) {
+		return nil, fmt.Errorf("got %d reason codes for %d subscriptions", len(sa.Reasons), len(subscriptions))
+	}
+	errs := make([]error, 0)
+	for i, code := range sa.Reasons {
+		s := subscriptions[i]
+		switch {
+		case code >= 0x80:
+			reason, ok := subackReasons[code]
+			if !ok {
+				reason = "unknown reason"
+			}
+			errs = append(errs, fmt.Errorf("subscription %s failed: 0x%02X %s", s.Topic, code, reason))
+		case code < s.QoS:
+			warnings = append(warnings, fmt.Sprintf("subscription %s granted QoS %d instead of %d",
+				s.Topic, code, s.QoS))
+		}
+	}
+	return warnings, errors.Join(errs...)
+}
@@ -0,0 +1,60 @@
+/*
+* Copyright 2025-2026 Thorsten A. Knieling
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*    http://www.apache.org/licenses/LICENSE-2.0
+*
+ */
+
+package ecoflow2db
+
+import (
+	"testing"
+
+	"github.com/eclipse/paho.golang/paho"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubscribeOptions(t *testing.T) {
+	qos := 2
+	topic := &Topic{Name: "tele/meter/SENSOR", Share: "ecoflow", Qos: &qos, RetainHandling: 2}
+	so := topic.subscribeOptions(0)
+	assert.Equal(t, paho.SubscribeOptions{Topic: "$share/ecoflow/tele/meter/SENSOR", QoS: 2,
+		RetainHandling: 2}, so)
+	assert.Equal(t, "tele/meter/SENSOR", topic.messageTopic())
+	assert.NoError(t, topic.validateSubscription())
+
+	topic = &Topic{Name: "$share/group/shellies/em/status", NoLocal: true}
+	so = topic.subscribeOptions(1)
+	assert.Equal(t, "$share/group/shellies/em/status", so.Topic)
+	assert.Equal(t, byte(1), so.QoS)
+	assert.Equal(t, "shellies/em/status", topic.messageTopic())
+	assert.Error(t, topic.validateSubscription())
+
+	config := &adapterConfig{Mqtt: &mqttConfig{Topics: []*Topic{topic}}}
+	assert.Equal(t, topic, config.topicMap()["shellies/em/status"])
+
+	qos = 3
+	assert.Error(t, (&Topic{Name: "x", Qos: &qos}).validateSubscription())
+	assert.Error(t, (&Topic{Name: "x", RetainHandling: 3}).validateSubscription())
+}
+
+func TestCheckSuback(t *testing.T) {
+	subscriptions := []paho.SubscribeOptions{{Topic: "a", QoS: 1}, {Topic: "b", QoS: 2}, {Topic: "$share/g/c", QoS: 0}}
+	warnings, err := checkSuback(subscriptions, &paho.Suback{Reasons: []byte{1, 2, 0}})
+	assert.NoError(t, err)
+	assert.Empty(t, warnings)
+
+	warnings, err = checkSuback(subscriptions, &paho.Suback{Reasons: []byte{0, 0x87, 0x9E}})
+	assert.Equal(t, []string{"subscription a granted QoS 0 instead of 1"}, warnings)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "subscription b failed: 0x87 not authorized")
+		assert.Contains(t, err.Error(), "subscription $share/g/c failed: 0x9E shared subscriptions not supported")
+	}
+
+	_, err = checkSuback(subscriptions, &paho.Suback{Reasons: []byte{0}})
+	assert.Error(t, err)
+}
@@ -0,0 +1,100 @@
+/*
+* Copyright 2025-2026 Thorsten A. Knieling
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*    http://www.apache.org/licenses/LICENSE-2.0
+*
+ */
+
+package ecoflow2db
+
+import (
+	"time"
+
+	"github.com/eclipse/paho.golang/paho"
+	"github.com/tknie/log"
+)
+
+// defaultTimeField destination containing the payload timestamp
+const defaultTimeField = "time"
+
+// defaultMaxFutureSeconds maximum seconds a payload timestamp may be ahead
+// of the receive time
+const defaultMaxFutureSeconds = 300
+
+// receivedProperty user property containing the original receive time of
+// replayed messages
+const receivedProperty = "ecoflow2db-received"
+
+// receivedTime receive time of the message, replayed messages use the
+// recorded receive time
+func receivedTime(m *paho.Publish) time.Time {
+	if m.Properties != nil {
+		if v := m.Properties.User.Get(receivedProperty); v != "" {
+			if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+				return t
+			}
+		}
+	}
+	return time.Now()
+}
+
+// timeField destination of the payload timestamp
+func (topic *Topic) timeField() string {
+	if topic.TimeField == "" {
+		return defaultTimeField
+	}
+	return topic.TimeField
+}
+
+// eventTime timestamp of the event. The mapped payload timestamp is used
+// if available, otherwise the receive time
+func (topic *Topic) eventTime(event map[string]interface{}, received time.Time) (time.Time, bool) {
+	if ts, ok := event[topic.timeField()].(time.Time); ok && !ts.IsZero() {
+		return ts, true
+	}
+	return received, false
+}
+
+// maxFuture maximum duration a payload timestamp may be ahead of the
+// receive time
+func (topic *Topic) maxFuture() time.Duration {
+	if topic.MaxFutureSeconds <= 0 {
+		return defaultMaxFutureSeconds * time.Second
+	}
+	return time.Duration(topic.MaxFutureSeconds) * time.Second
+}
+
+// checkEventTime check if the event need to be processed. Events older
+// than the last processed event or older than the maximum age are
+// dropped. Events too far in the future are dropped before they can move
+// the last processed event. The clock skew between meter and host is recorded
+func (topic *Topic) checkEventTime(event map[string]interface{}, received time.Time) bool {
+	stat := getTimingStatEntry(topic.Name)
+	ts, fromPayload := topic.eventTime(event, received)
+	if fromPayload {
+		stat.skew(received.Sub(ts))
+	}
+	if ts.Sub(received) > topic.maxFuture() {
+		stat.future.Add(1)
+		log.Log.Infof("Drop future event of topic %s: %v more than %v after receive time %v",
+			topic.Name, ts, topic.maxFuture(), received)
+		return false
+	}
+	if !topic.lastEvent.IsZero() && ts.Before(topic.lastEvent) {
+		stat.outdated.Add(1)
+		log.Log.Infof("Drop outdated event of topic %s: %v before last %v", topic.Name, ts, topic.lastEvent)
+		return false
+	}
+	if topic.MaxAgeSeconds > 0 && received.Sub(ts) > time.Duration(topic.MaxAgeSeconds)*time.Second {
+		stat.expired.Add(1)
+		log.Log.Infof("Drop expired event of topic %s: %v older than %ds", topic.Name, ts, topic.MaxAgeSeconds)
+		return false
+	}
+	topic.lastEvent = ts
+	stat.processed.Add(1)
+	return true
+}
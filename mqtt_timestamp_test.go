@@ -0,0 +1,63 @@
+/*
+* Copyright 2025-2026 Thorsten A. Knieling
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*    http://www.apache.org/licenses/LICENSE-2.0
+*
+ */
+
+package ecoflow2db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/eclipse/paho.golang/paho"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckEventTime(t *testing.T) {
+	topic := &Topic{Name: "test/timestamp", MaxAgeSeconds: 30}
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	stat := getTimingStatEntry(topic.Name)
+
+	assert.True(t, topic.checkEventTime(map[string]interface{}{"time": now.Add(-2 * time.Second)}, now))
+	assert.Equal(t, int64(2*time.Second), stat.skewLast.Load())
+	// older than the last processed event
+	assert.False(t, topic.checkEventTime(map[string]interface{}{"time": now.Add(-3 * time.Second)}, now))
+	// meter clock ahead of host
+	assert.True(t, topic.checkEventTime(map[string]interface{}{"time": now.Add(time.Second)}, now))
+	assert.Equal(t, int64(-time.Second), stat.skewMin.Load())
+	assert.Equal(t, int64(3*time.Second), stat.skewMax.Load())
+
+	topic.lastEvent = time.Time{}
+	assert.False(t, topic.checkEventTime(map[string]interface{}{"time": now.Add(-time.Minute)}, now))
+	// without payload timestamp the receive time is used
+	assert.True(t, topic.checkEventTime(map[string]interface{}{"power": 1.0}, now.Add(time.Minute)))
+	assert.Equal(t, uint64(3), stat.processed.Load())
+	assert.Equal(t, uint64(1), stat.outdated.Load())
+	assert.Equal(t, uint64(1), stat.expired.Load())
+
+	// a timestamp far in the future does not block later events
+	topic = &Topic{Name: "test/future", MaxFutureSeconds: 60}
+	stat = getTimingStatEntry(topic.Name)
+	assert.False(t, topic.checkEventTime(map[string]interface{}{"time": now.Add(24 * time.Hour)}, now))
+	assert.True(t, topic.lastEvent.IsZero())
+	assert.True(t, topic.checkEventTime(map[string]interface{}{"time": now.Add(30 * time.Second)}, now))
+	assert.True(t, topic.checkEventTime(map[string]interface{}{"time": now.Add(40 * time.Second)}, now.Add(time.Second)))
+	assert.Equal(t, uint64(1), stat.future.Load())
+	assert.Equal(t, uint64(2), stat.processed.Load())
+	assert.Equal(t, defaultMaxFutureSeconds*time.Second, (&Topic{}).maxFuture())
+
+	topic = &Topic{Name: "test/timefield", TimeField: "ts"}
+	ts, ok := topic.eventTime(map[string]interface{}{"ts": now}, now.Add(time.Second))
+	assert.True(t, ok)
+	assert.Equal(t, now, ts)
+
+	re := &recordEntry{Topic: "x", Timestamp: now, Payload: "1"}
+	assert.Equal(t, now, receivedTime(re.publish()).UTC())
+	assert.WithinDuration(t, time.Now(), receivedTime(&paho.Publish{Topic: "x"}), time.Second)
+}
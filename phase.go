@@ -0,0 +1,113 @@
+/*
+* Copyright 2025-2026 Thorsten A. Knieling
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*    http://www.apache.org/licenses/LICENSE-2.0
+*
+ */
+
+package ecoflow2db
+
+import (
+	"fmt"
+)
+
+const (
+	// NettingSum all phases are summed up by the meter (balancing meter)
+	NettingSum = "sum"
+	// NettingPhase each phase is netted separately, only the phase of the
+	// inverter can be compensated
+	NettingPhase = "phase"
+)
+
+// phaseCount number of phases of a three-phase meter
+const phaseCount = 3
+
+// phaseConfig phase configuration of the meter and the inverter. The
+// per-phase readings are taken from the destinations power_l1..power_l3,
+// exported power can be given in out_l1..out_l3
+type phaseConfig struct {
+	Netting       string `yaml:"netting"`
+	InverterPhase int    `yaml:"inverterPhase"`
+}
+
+// phaseReading power per phase, positive values are consumed power and
+// negative values are exported power
+type phaseReading [phaseCount]float64
+
+// validate check the phase configuration
+func (pc *phaseConfig) validate() error {
+	if pc == nil {
+		return nil
+	}
+	switch pc.Netting {
+	case "", NettingSum:
+	case NettingPhase:
+		if pc.InverterPhase < 1 || pc.InverterPhase > phaseCount {
+			return fmt.Errorf("inverter phase %d need to be in range 1-%d", pc.InverterPhase, phaseCount)
+		}
+	default:
+		return fmt.Errorf("unknown netting mode %s", pc.Netting)
+	}
+	return nil
+}
+
+// phaseKey event destination of the phase, phase starts with 1
+func phaseKey(name string, phase int) string {
+	return fmt.Sprintf("%s_l%d", name, phase)
+}
+
+// eventPhases per-phase reading of the event, false if the event does
+// not contain all phases
+func eventPhases(event map[string]interface{}) (phaseReading, bool) {
+	var reading phaseReading
+	for i := range reading {
+		power, ok := eventFloat(event, phaseKey("power", i+1))
+		if !ok {
+			return reading, false
+		}
+		out, _ := eventFloat(event, phaseKey("out", i+1))
+		reading[i] = power - out
+	}
+	return reading, true
+}
+
+// balance power and out value the controller need to compensate. With
+// sum netting the phases are summed up, with phase netting only the phase
+// of the inverter is used
+func (pc *phaseConfig) balance(reading phaseReading) (power, out float64) {
+	net := 0.0
+	if pc != nil && pc.Netting == NettingPhase {
+		net = reading[pc.InverterPhase-1]
+	} else {
+		for _, p := range reading {
+			net += p
+		}
+	}
+	if net < 0 {
+		return 0, -net
+	}
+	return net, 0
+}
+
+// eventBalance power and out value of the event. If phases are configured
+// and the event contains per-phase values, the phase balance is used.
+// Otherwise the power and out fields are used
+func eventBalance(event map[string]interface{}) (power, out float64, ok bool) {
+	pc := adapter.DefaultConfig.Phases
+	if pc != nil {
+		if reading, found := eventPhases(event); found {
+			power, out = pc.balance(reading)
+			return power, out, true
+		}
+	}
+	power, ok = eventFloat(event, "power")
+	if !ok {
+		return 0, 0, false
+	}
+	out, _ = eventFloat(event, "out")
+	return power, out, true
+}
@@ -0,0 +1,63 @@
+/*
+* Copyright 2025-2026 Thorsten A. Knieling
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*    http://www.apache.org/licenses/LICENSE-2.0
+*
+ */
+
+package ecoflow2db
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPhaseBalance(t *testing.T) {
+	phases := adapter.DefaultConfig.Phases
+	defer func() { adapter.DefaultConfig.Phases = phases }()
+
+	event := map[string]interface{}{"power": float64(0), "out": 124.75,
+		"power_l1": 120.5, "power_l2": -300.25, "power_l3": float64(55)}
+
+	adapter.DefaultConfig.Phases = nil
+	power, out, ok := eventBalance(event)
+	assert.True(t, ok)
+	assert.Equal(t, float64(0), power)
+	assert.Equal(t, 124.75, out)
+
+	adapter.DefaultConfig.Phases = &phaseConfig{Netting: NettingSum}
+	power, out, ok = eventBalance(event)
+	assert.True(t, ok)
+	assert.Equal(t, float64(0), power)
+	assert.Equal(t, 124.75, out)
+
+	adapter.DefaultConfig.Phases = &phaseConfig{Netting: NettingPhase, InverterPhase: 1}
+	power, out, ok = eventBalance(event)
+	assert.True(t, ok)
+	assert.Equal(t, 120.5, power)
+	assert.Equal(t, float64(0), out)
+
+	adapter.DefaultConfig.Phases.InverterPhase = 2
+	power, out, _ = eventBalance(event)
+	assert.Equal(t, float64(0), power)
+	assert.Equal(t, 300.25, out)
+
+	// exported power given separately per phase
+	power, out, _ = eventBalance(map[string]interface{}{"power_l1": float64(0), "out_l1": float64(10),
+		"power_l2": float64(20), "power_l3": float64(30)})
+	assert.Equal(t, float64(20), power)
+	assert.Equal(t, float64(0), out)
+
+	// missing phase falls back to the power field
+	_, _, ok = eventBalance(map[string]interface{}{"power_l1": float64(0)})
+	assert.False(t, ok)
+
+	assert.NoError(t, (&phaseConfig{}).validate())
+	assert.Error(t, (&phaseConfig{Netting: NettingPhase}).validate())
+	assert.Error(t, (&phaseConfig{Netting: "xyz"}).validate())
+}
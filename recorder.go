@@ -0,0 +1,176 @@
+/*
+* Copyright 2025-2026 Thorsten A. Knieling
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*    http://www.apache.org/licenses/LICENSE-2.0
+*
+ */
+
+package ecoflow2db
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+	"unicode/utf8"
+
+	"github.com/eclipse/paho.golang/paho"
+	"github.com/tknie/log"
+	"github.com/tknie/services"
+)
+
+const defaultRecordMaxFiles = 10
+
+type recordConfig struct {
+	File       string `yaml:"file"`
+	MaxSizeKB  int64  `yaml:"maxSizeKB"`
+	MaxMinutes int    `yaml:"maxMinutes"`
+	MaxFiles   int    `yaml:"maxFiles"`
+}
+
+// recordEntry recorded MQTT message. The payload is kept as string if it
+// is valid UTF-8, otherwise raw
+type recordEntry struct {
+	Topic     string    `json:"topic"`
+	QoS       byte      `json:"qos"`
+	Retain    bool      `json:"retain,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+	Payload   string    `json:"payload,omitempty"`
+	Raw       []byte    `json:"raw,omitempty"`
+}
+
+var recorder *rotatingFile
+
+// DryRun no power request is send to the Ecoflow API, the decision
+// is only logged
+var DryRun = false
+
+// startRecorder open recording file if recording is configured
+func (rc *recordConfig) startRecorder() {
+	if rc == nil || rc.File == "" {
+		return
+	}
+	maxFiles := rc.MaxFiles
+	if maxFiles == 0 {
+		maxFiles = defaultRecordMaxFiles
+	}
+	recorder = newRotatingFile(rc.File, rc.MaxSizeKB*1024,
+		time.Duration(rc.MaxMinutes)*time.Minute, maxFiles)
+	services.ServerMessage("Record MQTT traffic into %s", recorder.name)
+}
+
+// recordMessage append the received message to the recording file
+func recordMessage(m *paho.Publish, received time.Time) {
+	if recorder == nil {
+		return
+	}
+	re := &recordEntry{Topic: m.Topic, QoS: m.QoS, Retain: m.Retain, Timestamp: received}
+	if utf8.Valid(m.Payload) {
+		re.Payload = string(m.Payload)
+	} else {
+		re.Raw = m.Payload
+	}
+	b, err := json.Marshal(re)
+	if err != nil {
+		log.Log.Errorf("Error marshal record entry: %v", err)
+		return
+	}
+	err = recorder.writeLine(b)
+	if err != nil {
+		log.Log.Errorf("Error writing record entry: %v", err)
+	}
+}
+
+// publish recorded entry as MQTT message, the recording time is passed
+// as user property
+func (re *recordEntry) publish() *paho.Publish {
+	payload := re.Raw
+	if payload == nil {
+		payload = []byte(re.Payload)
+	}
+	return &paho.Publish{Topic: re.Topic, QoS: re.QoS, Retain: re.Retain, Payload: payload,
+		Properties: &paho.PublishProperties{User: paho.UserProperties{
+			{Key: receivedProperty, Value: re.Timestamp.Format(time.RFC3339Nano)}}}}
+}
+
+// replayEntries send all recorded entries of the files into the message
+// channel. The speed factor accelerate the replay, speed 0 sends without
+// any delay
+func replayEntries(files []string, speed float64, msgChan chan *paho.Publish) (int, error) {
+	counter := 0
+	var last time.Time
+	err := readLines(files, func(name string, line []byte) error {
+		re := &recordEntry{}
+		err := json.Unmarshal(line, re)
+		if err != nil {
+			log.Log.Errorf("Skip invalid record line in %s: %v", name, err)
+			return nil
+		}
+		if speed > 0 && !last.IsZero() && re.Timestamp.After(last) {
+			time.Sleep(time.Duration(float64(re.Timestamp.Sub(last)) / speed))
+		}
+		last = re.Timestamp
+		msgChan <- re.publish()
+		counter++
+		return nil
+	})
+	return counter, err
+}
+
+// sortByModTime sort files oldest first, the current recording file is
+// always the latest one
+func sortByModTime(files []string) {
+	modTime := make(map[string]time.Time)
+	for _, f := range files {
+		if fi, err := os.Stat(f); err == nil {
+			modTime[f] = fi.ModTime()
+		}
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		if modTime[files[i]].Equal(modTime[files[j]]) {
+			return files[i] < files[j]
+		}
+		return modTime[files[i]].Before(modTime[files[j]])
+	})
+}
+
+// ReplayRecording feed recorded MQTT traffic matching the file pattern
+// into the MQTT analyze loop. The replay runs always in dry run mode, no
+// power request is send to the Ecoflow API
+func ReplayRecording(pattern string, speed float64) {
+	DryRun = true
+	if adapter.Mqtt == nil {
+		fmt.Println("No MQTT topics configured")
+		return
+	}
+	files, err := filepath.Glob(pattern)
+	if err != nil || len(files) == 0 {
+		fmt.Println("No recording files found:", pattern)
+		return
+	}
+	sortByModTime(files)
+	if currentRequested == 0 {
+		currentRequested = float64(adapter.DefaultConfig.BaseRequest)
+	}
+	topicMap := adapter.topicMap()
+	msgChan := make(chan *paho.Publish)
+	stopped := make(chan bool)
+	go func() {
+		loopCounterAndCancelOutput(msgChan, nil, topicMap)
+		stopped <- true
+	}()
+	services.ServerMessage("Replay %d recording files with speed %0.1f", len(files), speed)
+	counter, err := replayEntries(files, speed, msgChan)
+	if err != nil {
+		services.ServerMessage("Error replaying recording: %v", err)
+	}
+	mqttDone <- true
+	<-stopped
+	services.ServerMessage("Replayed %d MQTT messages", counter)
+}
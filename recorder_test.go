@@ -0,0 +1,52 @@
+/*
+* Copyright 2025-2026 Thorsten A. Knieling
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*    http://www.apache.org/licenses/LICENSE-2.0
+*
+ */
+
+package ecoflow2db
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/eclipse/paho.golang/paho"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecordReplay(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "record.jsonl")
+	recorder = newRotatingFile(name, 200, 0, 5)
+	defer func() {
+		recorder.close()
+		recorder = nil
+	}()
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		recordMessage(&paho.Publish{Topic: "tele/meter/SENSOR", QoS: 1,
+			Payload: []byte(`{"ENERGY":{"Power":345.2}}`)}, start.Add(time.Duration(i)*time.Second))
+	}
+	recordMessage(&paho.Publish{Topic: "tele/meter/RAW", Payload: []byte{0x08, 0xff}}, start.Add(5*time.Second))
+	assert.NotEmpty(t, rotatedFiles(name))
+
+	files := allFiles(name)
+	msgChan := make(chan *paho.Publish, 10)
+	counter, err := replayEntries(files, 0, msgChan)
+	assert.NoError(t, err)
+	assert.Equal(t, 6, counter)
+	m := <-msgChan
+	assert.Equal(t, "tele/meter/SENSOR", m.Topic)
+	assert.Equal(t, byte(1), m.QoS)
+	assert.Equal(t, `{"ENERGY":{"Power":345.2}}`, string(m.Payload))
+	for i := 0; i < 4; i++ {
+		<-msgChan
+	}
+	m = <-msgChan
+	assert.Equal(t, []byte{0x08, 0xff}, m.Payload)
+}
@@ -0,0 +1,190 @@
+/*
+* Copyright 2025-2026 Thorsten A. Knieling
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*    http://www.apache.org/licenses/LICENSE-2.0
+*
+ */
+
+package ecoflow2db
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tknie/log"
+)
+
+const rotateSuffixLayout = "20060102-150405.000000"
+
+// rotatingFile append-only line file rotated if the maximum size or the
+// maximum age is reached. Rotated files get a timestamp suffix, only the
+// newest maxFiles rotated files are kept
+type rotatingFile struct {
+	name     string
+	maxSize  int64
+	maxAge   time.Duration
+	maxFiles int
+	mu       sync.Mutex
+	file     *os.File
+	size     int64
+	opened   time.Time
+}
+
+func newRotatingFile(name string, maxSize int64, maxAge time.Duration, maxFiles int) *rotatingFile {
+	return &rotatingFile{name: os.ExpandEnv(name), maxSize: maxSize, maxAge: maxAge, maxFiles: maxFiles}
+}
+
+// writeLine append the line and rotate before if needed
+func (rf *rotatingFile) writeLine(b []byte) error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	if rf.file != nil && ((rf.maxSize > 0 && rf.size+int64(len(b))+1 > rf.maxSize) ||
+		(rf.maxAge > 0 && time.Since(rf.opened) > rf.maxAge)) {
+		rf.rotate()
+	}
+	if rf.file == nil {
+		err := rf.open()
+		if err != nil {
+			return err
+		}
+	}
+	n, err := rf.file.Write(append(b, '\n'))
+	rf.size += int64(n)
+	return err
+}
+
+func (rf *rotatingFile) open() error {
+	f, err := os.OpenFile(rf.name, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	rf.file = f
+	rf.size = fi.Size()
+	rf.opened = time.Now()
+	return nil
+}
+
+// rotate close current file and rename it with timestamp suffix, old
+// rotated files exceeding maxFiles are removed
+func (rf *rotatingFile) rotate() {
+	rf.file.Close()
+	rf.file = nil
+	target := rf.name + "." + time.Now().Format(rotateSuffixLayout)
+	for i := 1; ; i++ {
+		if _, err := os.Stat(target); os.IsNotExist(err) {
+			break
+		}
+		target = fmt.Sprintf("%s.%s-%d", rf.name, time.Now().Format(rotateSuffixLayout), i)
+	}
+	err := os.Rename(rf.name, target)
+	if err != nil {
+		log.Log.Errorf("Error rotating file %s: %v", rf.name, err)
+		return
+	}
+	if rf.maxFiles <= 0 {
+		return
+	}
+	rotated := rotatedFiles(rf.name)
+	for len(rotated) > rf.maxFiles {
+		os.Remove(rotated[0])
+		rotated = rotated[1:]
+	}
+}
+
+// close close the current file
+func (rf *rotatingFile) close() {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	if rf.file != nil {
+		rf.file.Close()
+		rf.file = nil
+	}
+}
+
+// rotatedFiles all rotated files of the name, oldest first. Only files
+// with a rotation timestamp suffix are used, other files like backups
+// of the user are not touched
+func rotatedFiles(name string) []string {
+	files, err := filepath.Glob(name + ".*")
+	if err != nil {
+		return nil
+	}
+	rotated := make([]string, 0, len(files))
+	for _, f := range files {
+		if isRotateSuffix(strings.TrimPrefix(f, name+".")) {
+			rotated = append(rotated, f)
+		}
+	}
+	sort.Strings(rotated)
+	return rotated
+}
+
+// isRotateSuffix check if the suffix is a rotation timestamp, optionally
+// followed by a counter
+func isRotateSuffix(suffix string) bool {
+	if len(suffix) < len(rotateSuffixLayout) {
+		return false
+	}
+	if _, err := time.Parse(rotateSuffixLayout, suffix[:len(rotateSuffixLayout)]); err != nil {
+		return false
+	}
+	counter := suffix[len(rotateSuffixLayout):]
+	if counter == "" {
+		return true
+	}
+	n, err := strconv.Atoi(strings.TrimPrefix(counter, "-"))
+	return strings.HasPrefix(counter, "-") && err == nil && n > 0
+}
+
+// allFiles all rotated files and the current file, oldest first
+func allFiles(name string) []string {
+	return append(rotatedFiles(name), name)
+}
+
+// readLines read all lines of the given files in order, non-existing
+// files are skipped
+func readLines(files []string, f func(name string, line []byte) error) error {
+	for _, fn := range files {
+		err := readFileLines(fn, f)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readFileLines(name string, f func(name string, line []byte) error) error {
+	file, err := os.Open(name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		err = f(name, scanner.Bytes())
+		if err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
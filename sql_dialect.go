@@ -0,0 +1,203 @@
+/*
+* Copyright 2025-2026 Thorsten A. Knieling
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*    http://www.apache.org/licenses/LICENSE-2.0
+*
+ */
+
+package ecoflow2db
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/tknie/flynn/common"
+	"github.com/tknie/log"
+)
+
+// sqlDialect renders the backend specific parts of the flow query and DDL.
+// The exported methods are used in the SQL templates
+type sqlDialect interface {
+	// UTC expression of the timestamp column in GMT
+	UTC(column string) string
+	// MinuteKey expression formatting the timestamp as 'YYYYMMDD HHMI'
+	MinuteKey(expr string) string
+	// Since condition selecting the last minutes of the timestamp column
+	Since(column string, minutes int) string
+	// Float expression casting to floating point
+	Float(expr string) string
+	// IntDiv integer division of the expression
+	IntDiv(expr string, divisor int) string
+	// widenColumn DDL changing the column type
+	widenColumn(tn, column, sqlType string) string
+	// currentSchema expression of the schema tables are created in
+	currentSchema() string
+}
+
+type postgresDialect struct{}
+
+type mysqlDialect struct{}
+
+// dialectOf SQL dialect of the database driver, Postgres is the default
+func dialectOf(driver common.ReferenceType) sqlDialect {
+	if driver == common.MysqlType {
+		return mysqlDialect{}
+	}
+	return postgresDialect{}
+}
+
+// currentDialect SQL dialect of the configured database
+func currentDialect() sqlDialect {
+	if dbRef == nil {
+		return postgresDialect{}
+	}
+	return dialectOf(dbRef.Driver)
+}
+
+func (postgresDialect) UTC(column string) string {
+	return column + " at TIME zone 'GMT'"
+}
+
+func (postgresDialect) MinuteKey(expr string) string {
+	return fmt.Sprintf("to_char(%s, 'YYYYMMDD HH24MI')", expr)
+}
+
+func (d postgresDialect) Since(column string, minutes int) string {
+	return fmt.Sprintf("%s >= NOW() - '%d minute'::interval", d.UTC(column), minutes)
+}
+
+func (postgresDialect) Float(expr string) string {
+	return expr + "::float"
+}
+
+func (postgresDialect) IntDiv(expr string, divisor int) string {
+	return fmt.Sprintf("(%s) / %d", expr, divisor)
+}
+
+func (postgresDialect) widenColumn(tn, column, sqlType string) string {
+	return fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s TYPE %s USING %s::%s",
+		tn, column, sqlType, column, sqlType)
+}
+
+func (postgresDialect) currentSchema() string {
+	return "current_schema()"
+}
+
+func (mysqlDialect) UTC(column string) string {
+	return fmt.Sprintf("CONVERT_TZ(%s, @@session.time_zone, '+00:00')", column)
+}
+
+func (mysqlDialect) MinuteKey(expr string) string {
+	return fmt.Sprintf("DATE_FORMAT(%s, '%%Y%%m%%d %%H%%i')", expr)
+}
+
+func (mysqlDialect) Since(column string, minutes int) string {
+	return fmt.Sprintf("%s >= NOW() - INTERVAL %d MINUTE", column, minutes)
+}
+
+// Float adding a double constant works on MySQL and MariaDB versions
+// without CAST AS DOUBLE
+func (mysqlDialect) Float(expr string) string {
+	return fmt.Sprintf("(%s + 0E0)", expr)
+}
+
+func (mysqlDialect) IntDiv(expr string, divisor int) string {
+	return fmt.Sprintf("(%s) DIV %d", expr, divisor)
+}
+
+func (mysqlDialect) widenColumn(tn, column, sqlType string) string {
+	return fmt.Sprintf("ALTER TABLE %s MODIFY COLUMN %s %s", tn, column, sqlType)
+}
+
+func (mysqlDialect) currentSchema() string {
+	return "DATABASE()"
+}
+
+// resultInt64 integer of a query result value. Depending on the backend
+// numbers are returned as numbers or strings, NULL is returned as 0
+func resultInt64(v any) int64 {
+	switch val := v.(type) {
+	case nil:
+	case int64:
+		return val
+	case int32:
+		return int64(val)
+	case int16:
+		return int64(val)
+	case int:
+		return int64(val)
+	case uint64:
+		return int64(val)
+	case uint32:
+		return int64(val)
+	case float64:
+		return int64(val)
+	case float32:
+		return int64(val)
+	case string, []byte, pgtype.Numeric:
+		return int64(resultFloat64(val))
+	default:
+		log.Log.Errorf("Unknown integer result type %T: %v", v, v)
+	}
+	return 0
+}
+
+// resultFloat64 floating point number of a query result value
+func resultFloat64(v any) float64 {
+	switch val := v.(type) {
+	case float64:
+		return val
+	case float32:
+		return float64(val)
+	case int64, int32, int16, int, uint64, uint32:
+		return float64(resultInt64(val))
+	case []byte:
+		return resultFloat64(string(val))
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(val), 64)
+		if err == nil {
+			return f
+		}
+		log.Log.Errorf("Invalid number result: %s", val)
+	case pgtype.Numeric:
+		if !val.Valid {
+			return 0
+		}
+		f, err := val.Float64Value()
+		if err == nil {
+			return f.Float64
+		}
+		log.Log.Errorf("Invalid numeric result: %v", err)
+	case nil:
+	default:
+		log.Log.Errorf("Unknown number result type %T: %v", v, v)
+	}
+	return 0
+}
+
+// resultTime timestamp of a query result value
+func resultTime(v any) time.Time {
+	switch val := v.(type) {
+	case time.Time:
+		return val
+	case sql.NullTime:
+		return val.Time
+	case []byte:
+		return resultTime(string(val))
+	case string:
+		for _, l := range []string{time.RFC3339Nano, "2006-01-02 15:04:05.999999", "2006-01-02 15:04:05"} {
+			if t, err := time.Parse(l, val); err == nil {
+				return t
+			}
+		}
+	}
+	return time.Time{}
+}
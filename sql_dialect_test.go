@@ -0,0 +1,129 @@
+/*
+* Copyright 2025-2026 Thorsten A. Knieling
+*
+* Licensed under the Apache License, Version 2.0 (the "License");
+* you may not use this file except in compliance with the License.
+* You may obtain a copy of the License at
+*
+*    http://www.apache.org/licenses/LICENSE-2.0
+*
+ */
+
+package ecoflow2db
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/stretchr/testify/assert"
+	"github.com/tknie/flynn"
+	"github.com/tknie/flynn/common"
+)
+
+func TestFlowQueryDialects(t *testing.T) {
+	pg := flowQuery(dialectOf(common.PostgresType), "device_quota", "home", "HW51", "R331")
+	assert.Contains(t, pg, "to_char(dq.eco_timestamp at TIME zone 'GMT', 'YYYYMMDD HH24MI') as timest")
+	assert.Contains(t, pg, "eco_timestamp at TIME zone 'GMT' >= NOW() - '30 minute'::interval")
+	assert.Contains(t, pg, "abs(least( eco_20_1_batinputwatts::float / 10, 0)) as batinput")
+	assert.Contains(t, pg, "b.timest = to_char(h.inserted_on, 'YYYYMMDD HH24MI')")
+	assert.Contains(t, pg, "dq.eco_serial_number = upper('R331')")
+
+	my := flowQuery(dialectOf(common.MysqlType), "device_quota", "home", "HW51", "R331")
+	assert.Contains(t, my, "DATE_FORMAT(CONVERT_TZ(dq.eco_timestamp, @@session.time_zone, '+00:00'), '%Y%m%d %H%i') as timest")
+	assert.Contains(t, my, "eco_timestamp >= NOW() - INTERVAL 30 MINUTE")
+	assert.Contains(t, my, "(eco_20_1_pv1inputwatts + eco_20_1_pv2inputwatts) DIV 10 as solargen")
+	assert.Contains(t, my, "abs((eco_20_1_gridconswatts + 0E0) / 10) as gridwatts")
+	for _, pgOnly := range []string{"::", "at TIME zone", "to_char", "\""} {
+		assert.NotContains(t, my, pgOnly)
+	}
+}
+
+func TestParseFlowRow(t *testing.T) {
+	ts := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	fields := []string{"inserted_on", "batfill", "powercurr", "powerout", "solargen", "batinput",
+		"batout", "housein", "gridwatts", "requested", "batreqfill"}
+	fieldMap := make(map[string]int)
+	for i, f := range fields {
+		fieldMap[f] = i
+	}
+	// Postgres returns typed values
+	p := parseFlowRow(fieldMap, []any{ts, int64(80), int32(300), int32(0), int64(120), 1.5,
+		0.0, int64(200), 12.5, int64(150), nil})
+	// MySQL returns strings for numbers and datetimes
+	m := parseFlowRow(fieldMap, []any{"2025-06-01T12:00:00Z", "80", "300", "0", "120", "1.5",
+		"0", "200", "12.5", "150", nil})
+	assert.Equal(t, p, m)
+	assert.Equal(t, ts, m.timestamp)
+	assert.Equal(t, int32(300), m.powercurr)
+	assert.Equal(t, 12.5, m.gridwatts)
+
+	var n pgtype.Numeric
+	assert.NoError(t, n.Scan("12.5"))
+	assert.Equal(t, 12.5, resultFloat64(n))
+	assert.Equal(t, int64(12), resultInt64(n))
+	assert.Equal(t, float64(0), resultFloat64(pgtype.Numeric{}))
+	assert.Equal(t, int64(0), resultInt64(nil))
+}
+
+// TestFlowQueryMysql run the flow query against the MySQL or MariaDB
+// database given by ECOFLOW_TEST_MYSQL_URL
+func TestFlowQueryMysql(t *testing.T) {
+	url := os.Getenv("ECOFLOW_TEST_MYSQL_URL")
+	if url == "" {
+		t.Skip("ECOFLOW_TEST_MYSQL_URL not set")
+	}
+	ref, password, err := common.NewReference(url)
+	if !assert.NoError(t, err) {
+		return
+	}
+	id, err := flynn.Handler(ref, password)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer id.Close()
+	tn := "ecoflow2db_test_quota"
+	tnHome := "ecoflow2db_test_home"
+	for _, batch := range []string{"DROP TABLE IF EXISTS " + tn, "DROP TABLE IF EXISTS " + tnHome,
+		"CREATE TABLE " + tn + " (eco_timestamp DATETIME, eco_serial_number VARCHAR(32), " +
+			"eco_bms_bmsstatus_actsoc BIGINT, eco_20_1_pv1inputwatts BIGINT, eco_20_1_pv2inputwatts BIGINT, " +
+			"eco_20_1_batinputwatts BIGINT, eco_20_1_genewatt BIGINT, eco_20_1_gridconswatts BIGINT, " +
+			"eco_20_1_invdemandwatts BIGINT, eco_20_1_bmsreqchgamp BIGINT)",
+		"CREATE TABLE " + tnHome + " (inserted_on DATETIME, powercurr INT, powerout INT)",
+		"INSERT INTO " + tn + " (eco_timestamp, eco_serial_number, eco_bms_bmsstatus_actsoc) VALUES (NOW(), 'BAT1', 80)",
+		"INSERT INTO " + tn + " VALUES (NOW(), 'CONV1', NULL, 100, 200, -150, 2000, 125, 1500, 3)",
+		"INSERT INTO " + tnHome + " VALUES (UTC_TIMESTAMP(), 300, 20)"} {
+		if !assert.NoError(t, id.Batch(batch), batch) {
+			return
+		}
+	}
+	defer id.Batch("DROP TABLE " + tn)
+	defer id.Batch("DROP TABLE " + tnHome)
+
+	entries := make([]*parameter, 0)
+	fieldMap := make(map[string]int)
+	err = readBatch(id, tn, flowQuery(dialectOf(ref.Driver), tn, tnHome, "conv1", "bat1"),
+		func(search *common.Query, result *common.Result) error {
+			for i, field := range result.Fields {
+				fieldMap[field] = i
+			}
+			entries = append(entries, parseFlowRow(fieldMap, result.Rows))
+			return nil
+		})
+	assert.NoError(t, err)
+	if assert.Len(t, entries, 1) {
+		p := entries[0]
+		assert.Equal(t, int64(80), p.batfill)
+		assert.Equal(t, int64(30), p.solargen)
+		assert.Equal(t, 15.0, p.batinput)
+		assert.Equal(t, 0.0, p.batout)
+		assert.Equal(t, int64(200), p.housein)
+		assert.Equal(t, 12.5, p.gridwatts)
+		assert.Equal(t, int64(150), p.requested)
+		assert.Equal(t, int64(3), p.batreqfill)
+		assert.Equal(t, int32(300), p.powercurr)
+		assert.Equal(t, int32(20), p.powerout)
+		assert.WithinDuration(t, time.Now().UTC(), p.timestamp, 2*time.Minute)
+	}
+}
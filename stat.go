@@ -14,6 +14,9 @@ package ecoflow2db
 import (
 	"bytes"
 	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/tknie/ecoflow"
@@ -23,13 +26,46 @@ import (
 
 var StatLoopMinutes = time.Duration(5)
 
+// statDatabase insert statistics of a table
 type statDatabase struct {
-	counter uint64
+	counter    atomic.Uint64
+	flushes    atomic.Uint64
+	failed     atomic.Uint64
+	latency    atomic.Int64
+	latencyMax atomic.Int64
+	pruned     atomic.Uint64
+	suppressed atomic.Uint64
 }
 
 var mapStatDatabase = make(map[string]*statDatabase)
 
+type statMapping struct {
+	skipped   atomic.Uint64
+	defaulted atomic.Uint64
+}
+
+var mapStatMapping = make(map[string]*statMapping)
+
+// statTiming event timestamp statistics of a topic, skew is the host time
+// minus the payload timestamp
+type statTiming struct {
+	processed atomic.Uint64
+	outdated  atomic.Uint64
+	expired   atomic.Uint64
+	future    atomic.Uint64
+	skewLast  atomic.Int64
+	skewMin   atomic.Int64
+	skewMax   atomic.Int64
+}
+
+var mapStatTiming = make(map[string]*statTiming)
+var deadLetterCounter atomic.Uint64
+var mapStatProtobuf = make(map[string]*atomic.Uint64)
+var statLock sync.Mutex
+
 func getDbStatEntry(tn string) *statDatabase {
+	statLock.Lock()
+	defer statLock.Unlock()
 	if s, ok := mapStatDatabase[tn]; ok {
 		return s
 	} else {
@@ -39,6 +75,107 @@ func getDbStatEntry(tn string) *statDatabase {
 	}
 }
 
+// flushed record one flush of the write buffer
+func (sd *statDatabase) flushed(latency time.Duration, records int, err error) {
+	sd.flushes.Add(1)
+	if err != nil {
+		sd.failed.Add(uint64(records))
+	} else {
+		sd.counter.Add(uint64(records))
+	}
+	sd.latency.Add(int64(latency))
+	for {
+		max := sd.latencyMax.Load()
+		if int64(latency) <= max || sd.latencyMax.CompareAndSwap(max, int64(latency)) {
+			return
+		}
+	}
+}
+
+// String statistic output of the table
+func (sd *statDatabase) String() string {
+	flushes := sd.flushes.Load()
+	s := fmt.Sprintf("inserted %03d records", sd.counter.Load())
+	if flushes > 0 {
+		s = fmt.Sprintf("inserted %03d records failed %03d flushes %03d latency avg %v max %v",
+			sd.counter.Load(), sd.failed.Load(), flushes,
+			time.Duration(sd.latency.Load()/int64(flushes)), time.Duration(sd.latencyMax.Load()))
+	}
+	if pruned := sd.pruned.Load(); pruned > 0 {
+		s += fmt.Sprintf(" pruned %03d records", pruned)
+	}
+	if suppressed := sd.suppressed.Load(); suppressed > 0 {
+		s += fmt.Sprintf(" unchanged %03d records", suppressed)
+	}
+	return s
+}
+
+// getMappingStatEntry get conversion statistics of the given topic
+func getMappingStatEntry(topic string) *statMapping {
+	statLock.Lock()
+	defer statLock.Unlock()
+	if s, ok := mapStatMapping[topic]; ok {
+		return s
+	}
+	stat := &statMapping{}
+	mapStatMapping[topic] = stat
+	return stat
+}
+
+// getTimingStatEntry get event timestamp statistics of the given topic
+func getTimingStatEntry(topic string) *statTiming {
+	statLock.Lock()
+	defer statLock.Unlock()
+	if s, ok := mapStatTiming[topic]; ok {
+		return s
+	}
+	stat := &statTiming{}
+	stat.skewMin.Store(math.MaxInt64)
+	stat.skewMax.Store(math.MinInt64)
+	mapStatTiming[topic] = stat
+	return stat
+}
+
+// skew record the clock skew between meter and host
+func (st *statTiming) skew(d time.Duration) {
+	st.skewLast.Store(int64(d))
+	for {
+		min := st.skewMin.Load()
+		if int64(d) >= min || st.skewMin.CompareAndSwap(min, int64(d)) {
+			break
+		}
+	}
+	for {
+		max := st.skewMax.Load()
+		if int64(d) <= max || st.skewMax.CompareAndSwap(max, int64(d)) {
+			break
+		}
+	}
+}
+
+// String statistic output of the event timestamps
+func (st *statTiming) String() string {
+	if st.skewMin.Load() > st.skewMax.Load() {
+		return fmt.Sprintf("processed %03d outdated %03d expired %03d future %03d",
+			st.processed.Load(), st.outdated.Load(), st.expired.Load(), st.future.Load())
+	}
+	return fmt.Sprintf("processed %03d outdated %03d expired %03d future %03d skew %v [%v:%v]",
+		st.processed.Load(), st.outdated.Load(), st.expired.Load(), st.future.Load(),
+		time.Duration(st.skewLast.Load()), time.Duration(st.skewMin.Load()), time.Duration(st.skewMax.Load()))
+}
+
+// protobufStat count decoded protobuf frames of the given type
+func protobufStat(frame string) {
+	statLock.Lock()
+	defer statLock.Unlock()
+	c, ok := mapStatProtobuf[frame]
+	if !ok {
+		c = &atomic.Uint64{}
+		mapStatProtobuf[frame] = c
+	}
+	c.Add(1)
+}
+
 func startStatLoop() {
 	ticker := time.NewTicker(StatLoopMinutes * time.Minute)
 	go func() {
@@ -48,8 +185,35 @@ func startStatLoop() {
 				var buffer bytes.Buffer
 				buffer.WriteString("Statistics: ")
 				buffer.WriteString(ecoflow.StatMqtt())
+				statLock.Lock()
 				for k, v := range mapStatDatabase {
-					buffer.WriteString(fmt.Sprintf("%s inserted %03d records ", k, v.counter))
+					buffer.WriteString(fmt.Sprintf("%s %s ", k, v.String()))
+				}
+				for k, v := range mapStatMapping {
+					buffer.WriteString(fmt.Sprintf("%s conversion skipped %03d defaulted %03d fields ",
+						k, v.skipped.Load(), v.defaulted.Load()))
+				}
+				for k, v := range mapStatTiming {
+					buffer.WriteString(fmt.Sprintf("%s events %s ", k, v.String()))
+				}
+				for k, v := range mapStatProtobuf {
+					buffer.WriteString(fmt.Sprintf("protobuf %s got %03d frames ", k, v.Load()))
+				}
+				statLock.Unlock()
+				if writer != nil && writer.spool != nil {
+					buffer.WriteString(writer.spool.String())
+				}
+				if rollups != nil {
+					buffer.WriteString(rollups.String())
+				}
+				if mqttQueue != nil {
+					buffer.WriteString(mqttQueue.String())
+				}
+				for _, m := range adapter.meterSources() {
+					buffer.WriteString(meterString(m))
+				}
+				if c := deadLetterCounter.Load(); c > 0 {
+					buffer.WriteString(fmt.Sprintf("dead-letter stored %03d payloads ", c))
 				}
 				log.Log.Infof(buffer.String())
 			case <-quit: